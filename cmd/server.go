@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/limiter"
 	"rate-limiting-service/internal/logger"
+	"rate-limiting-service/internal/rpc"
 	"rate-limiting-service/internal/services"
 	"rate-limiting-service/internal/storage"
 	"rate-limiting-service/internal/utils"
@@ -20,10 +22,69 @@ import (
 )
 
 func main() {
+	limitsFile := flag.String("limits", config.LIMITS_FILE, "YAML or JSON file of limits to configure at startup")
+	authMappingsFile := flag.String("auth-mappings", config.AUTH_MAPPINGS_FILE, "YAML or JSON file mapping forwarded requests to keys for /auth")
+	dryRun := flag.Bool("dry-run", false, "validate the limits file and exit")
+	flag.Parse()
+	if *dryRun {
+		validateLimitsFile(*limitsFile)
+		return
+	}
+
 	logger.InitLogger("logs.csv", 1000)
 	storage.GetManager()
+	limiter.GetManager().SubscribeConfigurationUpdates()
+	loadLimitsFile(*limitsFile)
+	authMappings := loadAuthMappings(*authMappingsFile)
 	startSyncJob()
-	startServer()
+	startServer(authMappings)
+}
+
+func validateLimitsFile(path string) {
+	if path == "" {
+		log.Fatal("-dry-run requires a limits file")
+	}
+	limits, err := services.ReadLimitsFile(path)
+	if err == nil {
+		err = limits.Validate()
+	}
+	if err != nil {
+		log.Fatal("Invalid limits file:\n", err)
+	}
+	fmt.Printf("Limits file is valid: %d keys\n", len(limits))
+}
+
+func loadLimitsFile(path string) {
+	if path == "" {
+		return
+	}
+	limits, err := services.ReadLimitsFile(path)
+	if err == nil {
+		err = limits.Validate()
+	}
+	if err == nil {
+		err = limits.Apply(nil)
+	}
+	if err != nil {
+		log.Fatal("Failed to load limits file:\n", err)
+	}
+	fmt.Printf("Limits file loaded: %d keys\n", len(limits))
+	services.WatchLimitsFile(path, limits, config.LIMITS_FILE_POLL_INTERVAL_IN_SECS*time.Second)
+}
+
+func loadAuthMappings(path string) services.AuthMappings {
+	if path == "" {
+		return nil
+	}
+	mappings, err := services.ReadAuthMappings(path)
+	if err == nil {
+		err = mappings.Validate()
+	}
+	if err != nil {
+		log.Fatal("Failed to load auth mappings:\n", err)
+	}
+	fmt.Printf("Auth mappings loaded: %d mappings\n", len(mappings))
+	return mappings
 }
 
 type structValidator struct {
@@ -34,13 +95,13 @@ func (v *structValidator) Validate(out any) error {
 	return v.validate.Struct(out)
 }
 
-func startServer() {
+func startServer(authMappings services.AuthMappings) {
 	app := fiber.New(fiber.Config{
 		StructValidator: &structValidator{validate: validator.New()},
 	})
 
 	app.Use(func(c fiber.Ctx) error {
-		if c.Path() == "/check" && c.Method() == "GET" {
+		if (c.Path() == "/check" && c.Method() == "GET") || c.Path() == "/auth" {
 			t1 := time.Now()
 			nextErr := c.Next()
 			allowed := c.Response().StatusCode() != http.StatusTooManyRequests
@@ -58,28 +119,93 @@ func startServer() {
 			utils.SendValidationErrors(err, c)
 			return err
 		}
-		allowed, headers, err := services.Check(checkDto)
+		return sendCheck(c, "/check", checkDto, false)
+	})
+	// /status answers like /check without taking anything from the limiter,
+	// for dashboards and pre-flight checks.
+	app.Get("/status", func(c fiber.Ctx) error {
+		checkDto := new(services.CheckDTO)
+		if err := c.Bind().Query(checkDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		allowed, headers, err := services.Peek(checkDto)
 		if err != nil {
-			if validationErrors, ok := err.(validator.ValidationErrors); ok {
-				utils.SendValidationErrors(validationErrors, c)
-				return nil
+			switch err.Error() {
+			case "rate limiter not found":
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			case "rate limiter does not support peek":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			case storage.ErrUnavailable:
+				return c.Status(http.StatusServiceUnavailable).SendString(err.Error())
 			}
+			fmt.Println("/status error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		for key, value := range headers {
+			c.Response().Header.Add(key, value)
+		}
+		return c.JSON(services.NewStatusResponse(allowed, headers))
+	})
+	app.Post("/check/batch", func(c fiber.Ctx) error {
+		checkBatchDto := new(services.CheckBatchDTO)
+		if err := c.Bind().Body(checkBatchDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
 		}
+		response, err := services.CheckBatch(checkBatchDto)
 		if err != nil {
-			if err.Error() == "rate limiter not found" {
+			switch err.Error() {
+			case "rate limiter not found":
 				return c.Status(http.StatusNotFound).SendString("rate limiter not found")
+			case storage.ErrUnavailable:
+				return c.Status(http.StatusServiceUnavailable).SendString(err.Error())
 			}
+			fmt.Println("/check/batch error:", err)
 			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
 		}
-		for key, value := range headers {
-			c.Response().Header.Add(key, value)
+		if !response.Allowed && checkBatchDto.Mode == services.CHECK_BATCH_ALL_OR_NOTHING {
+			c.Status(http.StatusTooManyRequests)
 		}
-		if allowed {
-			c.Status(http.StatusOK)
-			return nil
+		return c.JSON(response)
+	})
+	// /auth answers NGINX auth_request and Traefik ForwardAuth, checking the
+	// forwarded request with the key and args of its auth mapping. Requests
+	// no mapping matches aren't limited.
+	app.All("/auth", func(c fiber.Ctx) error {
+		authRequest := services.NewAuthRequest(func(name string) string { return c.Get(name) },
+			c.Hostname(), c.OriginalURL(), c.Method(), c.IP())
+		checkDto := authMappings.Resolve(authRequest)
+		if checkDto == nil {
+			return c.SendStatus(http.StatusOK)
 		}
-		c.Status(http.StatusTooManyRequests)
-		return nil
+		return sendCheck(c, "/auth", checkDto, true)
+	})
+	app.Post("/release", func(c fiber.Ctx) error {
+		releaseDto := new(services.ReleaseDTO)
+		if err := c.Bind().Query(releaseDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		err := services.Release(releaseDto)
+		if err != nil {
+			if validationErrors, ok := err.(validator.ValidationErrors); ok {
+				utils.SendValidationErrors(validationErrors, c)
+				return nil
+			}
+		}
+		if err != nil {
+			switch err.Error() {
+			case "rate limiter not found", "lease not found":
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			case "rate limiter does not support release":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			case storage.ErrUnavailable:
+				return c.Status(http.StatusServiceUnavailable).SendString(err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendString("released")
 	})
 	app.Post("/configure", func(c fiber.Ctx) error {
 		configDto := new(services.ConfigureDTO)
@@ -87,6 +213,7 @@ func startServer() {
 			utils.SendValidationErrors(err, c)
 			return err
 		}
+		configDto.Author = requestAuthor(c)
 		err := services.Configure(configDto)
 		if err != nil {
 			if validationErrors, ok := err.(validator.ValidationErrors); ok {
@@ -95,11 +222,152 @@ func startServer() {
 			}
 		}
 		if err != nil {
+			switch err.Error() {
+			case "unknown limiter type", "strict consistency is not supported by this limiter type":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			}
 			fmt.Println("/configure error:", err)
 			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
 		}
 		return c.SendString("configured")
 	})
+	app.Get("/configure", func(c fiber.Ctx) error {
+		listDto := new(services.ListConfigurationsDTO)
+		if err := c.Bind().Query(listDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		response, err := services.ListConfigurations(listDto)
+		if err != nil {
+			fmt.Println("/configure list error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.JSON(response)
+	})
+	app.Get("/configure/:key", func(c fiber.Ctx) error {
+		configuration, err := services.GetConfiguration(c.Params("key"))
+		if err != nil {
+			if err.Error() == "key not configured" {
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.JSON(configuration)
+	})
+	app.Put("/configure/:key", func(c fiber.Ctx) error {
+		configurationDto := new(services.ConfigurationDTO)
+		if err := c.Bind().Body(configurationDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		err := services.Configure(&services.ConfigureDTO{
+			Key:           c.Params("key"),
+			LimiterType:   configurationDto.LimiterType,
+			Configuration: configurationDto.Configuration,
+			Consistency:   configurationDto.Consistency,
+			Author:        requestAuthor(c),
+		})
+		if err != nil {
+			if validationErrors, ok := err.(validator.ValidationErrors); ok {
+				utils.SendValidationErrors(validationErrors, c)
+				return nil
+			}
+		}
+		if err != nil {
+			switch err.Error() {
+			case "unknown limiter type", "strict consistency is not supported by this limiter type":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			}
+			fmt.Println("/configure error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendString("configured")
+	})
+	app.Delete("/configure/:key", func(c fiber.Ctx) error {
+		err := services.DeleteConfiguration(c.Params("key"), requestAuthor(c))
+		if err != nil {
+			if err.Error() == "key not configured" {
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			}
+			fmt.Println("/configure delete error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+	app.Get("/configure/:key/history", func(c fiber.Ctx) error {
+		versions, err := services.GetConfigurationHistory(c.Params("key"))
+		if err != nil {
+			if err.Error() == "key has no history" {
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.JSON(versions)
+	})
+	app.Post("/configure/:key/rollback", func(c fiber.Ctx) error {
+		rollbackDto := new(services.RollbackDTO)
+		if err := c.Bind().Query(rollbackDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		err := services.RollbackConfiguration(c.Params("key"), rollbackDto, requestAuthor(c))
+		if err != nil {
+			switch err.Error() {
+			case "version not found":
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			case "version is a deletion":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			}
+			fmt.Println("/configure rollback error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendString("rolled back")
+	})
+	app.Post("/configure/:key/overrides", func(c fiber.Ctx) error {
+		overrideDto := new(services.OverrideDTO)
+		if err := c.Bind().Body(overrideDto); err != nil {
+			utils.SendValidationErrors(err, c)
+			return err
+		}
+		err := services.ConfigureOverride(c.Params("key"), overrideDto)
+		if err != nil {
+			if validationErrors, ok := err.(validator.ValidationErrors); ok {
+				utils.SendValidationErrors(validationErrors, c)
+				return nil
+			}
+		}
+		if err != nil {
+			switch err.Error() {
+			case "key not configured":
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			case "unknown limiter type", "syntax error in pattern":
+				return c.Status(http.StatusBadRequest).SendString(err.Error())
+			}
+			fmt.Println("/configure overrides error:", err)
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendString("configured")
+	})
+	app.Get("/configure/:key/overrides", func(c fiber.Ctx) error {
+		overrides, err := services.GetOverrides(c.Params("key"))
+		if err != nil {
+			if err.Error() == "key not configured" {
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.JSON(overrides)
+	})
+	app.Delete("/configure/:key/overrides/:name", func(c fiber.Ctx) error {
+		err := services.DeleteOverride(c.Params("key"), c.Params("name"))
+		if err != nil {
+			if err.Error() == "override not found" {
+				return c.Status(http.StatusNotFound).SendString(err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
 	app.Get("/metrics", func(c fiber.Ctx) error {
 		reset := c.Query("reset", "")
 		if reset == "true" {
@@ -119,14 +387,72 @@ func startServer() {
 			log.Fatal("Fiber stopped:", err)
 		}
 	}()
+	grpcServer, err := rpc.Serve(config.GRPC_PORT)
+	if err != nil {
+		log.Fatal("gRPC not started:", err)
+	}
 
 	<-quit
 	fmt.Println("Shutting down...")
+	grpcServer.GracefulStop()
 	limiter.GetManager().StopAll()
 	app.Shutdown()
 	fmt.Println("Shutdown complete.")
 }
 
+// requestAuthor names who made a configuration change: the X-Author header
+// if set, the client address otherwise.
+func requestAuthor(c fiber.Ctx) string {
+	if author := c.Get("X-Author"); author != "" {
+		return author
+	}
+	return c.IP()
+}
+
+// sendCheck answers with the result of checkDto: 200 or 429 along with the
+// limiter headers. Reverse proxies get no body but a Retry-After on every 429,
+// the others the /check body.
+func sendCheck(c fiber.Ctx, path string, checkDto *services.CheckDTO, forwardAuth bool) error {
+	check := services.Check
+	if forwardAuth {
+		check = services.CheckAuth
+	}
+	allowed, headers, err := check(checkDto)
+	if err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			utils.SendValidationErrors(validationErrors, c)
+			return nil
+		}
+	}
+	if err != nil {
+		switch err.Error() {
+		case "rate limiter not found":
+			return c.Status(http.StatusNotFound).SendString("rate limiter not found")
+		case "concurrency limiters can't be used with /auth":
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		case storage.ErrUnavailable:
+			return c.Status(http.StatusServiceUnavailable).SendString(err.Error())
+		}
+		fmt.Println(path+" error:", err)
+		return c.Status(http.StatusInternalServerError).SendString("Internal server error")
+	}
+	for key, value := range headers {
+		c.Response().Header.Add(key, value)
+	}
+	if allowed {
+		c.Status(http.StatusOK)
+		if response := services.NewCheckResponse(allowed, headers); !forwardAuth && response != nil {
+			return c.JSON(response)
+		}
+		return nil
+	}
+	if _, exists := headers["Retry-After"]; forwardAuth && !exists && headers["X-RateLimit-Reset"] != "" {
+		c.Set("Retry-After", headers["X-RateLimit-Reset"])
+	}
+	c.Status(http.StatusTooManyRequests)
+	return nil
+}
+
 func startSyncJob() {
 	go func() {
 		ticker := time.NewTicker(10 * time.Millisecond)
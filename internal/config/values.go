@@ -3,11 +3,20 @@ package config
 import "rate-limiting-service/internal/utils"
 
 var (
-	PORT           = GetConfig("PORT", "3123")
-	REDIS_ADDRESS  = GetConfig("REDIS_ADDRESS", "localhost:6379")
-	REDIS_USERNAME = GetConfig("REDIS_USERNAME", "")
-	REDIS_PASSWORD = GetConfig("REDIS_PASSWORD", "")
-	REDIS_TLS_ON   = GetConfig("REDIS_TLS_ON", "")
+	PORT                    = GetConfig("PORT", "3123")
+	GRPC_PORT               = GetConfig("GRPC_PORT", "3124")
+	REDIS_ADDRESS           = GetConfig("REDIS_ADDRESS", "localhost:6379")
+	REDIS_USERNAME          = GetConfig("REDIS_USERNAME", "")
+	REDIS_PASSWORD          = GetConfig("REDIS_PASSWORD", "")
+	REDIS_TLS_ON            = GetConfig("REDIS_TLS_ON", "")
+	REDIS_MODE              = GetConfig("REDIS_MODE", "standalone")
+	REDIS_MASTER_NAME       = GetConfig("REDIS_MASTER_NAME", "")
+	REDIS_SENTINEL_PASSWORD = GetConfig("REDIS_SENTINEL_PASSWORD", "")
+	LIMITS_FILE             = GetConfig("LIMITS_FILE", "")
+	AUTH_MAPPINGS_FILE      = GetConfig("AUTH_MAPPINGS_FILE", "")
+	STORAGE_BACKEND         = GetConfig("STORAGE_BACKEND", "redis")
+	DISK_STORAGE_PATH       = GetConfig("DISK_STORAGE_PATH", "data/storage.log")
+	DEGRADED_MODE           = GetConfig("DEGRADED_MODE", "local")
 )
 
 var (
@@ -15,5 +24,8 @@ var (
 )
 
 const (
-	SYNC_LIMITER_FREQUENCY_TIME_IN_MS = 15
+	SYNC_LIMITER_FREQUENCY_TIME_IN_MS    = 15
+	LIMITS_FILE_POLL_INTERVAL_IN_SECS    = 5
+	CIRCUIT_BREAKER_FAILURE_THRESHOLD    = 3
+	CIRCUIT_BREAKER_RETRY_INTERVAL_IN_MS = 1000
 )
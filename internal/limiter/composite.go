@@ -0,0 +1,205 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rate-limiting-service/internal/storage"
+	"strconv"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// CompositeLimiter enforces several limits on one key. A check is consumed
+// from every sub-limit only when all of them allow it. Each sub-limit is a
+// regular limiter configured under "<key>#<index>".
+type CompositeLimiter struct {
+	lock      sync.Mutex              `json:"-"`
+	key       string                  `json:"-"`
+	args      []string                `json:"-"`
+	limiters  []*Limiter              `json:"-"`
+	subLimits []subLimitConfiguration `json:"-"`
+	Limits    int                     `json:"limits"`
+}
+
+type subLimitConfiguration struct {
+	LimiterType   LimiterType     `json:"limiterType" validate:"required" message:"limiterType is required"`
+	Configuration json.RawMessage `json:"configuration" validate:"required" message:"configuration is required"`
+}
+
+func subLimitKey(key string, index int) string {
+	return fmt.Sprintf("%s#%d", key, index)
+}
+
+func (c *CompositeLimiter) Check(cost int) (bool, map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return checkAll(c.limiters, cost)
+}
+
+// checkAll consumes cost from every limiter, or from none of them if any one
+// denies or fails, and returns the most restrictive headers.
+func checkAll(limiters []*Limiter, cost int) (bool, map[string]string, error) {
+	var result map[string]string
+	for i, rateLimiter := range limiters {
+		allowed, headers, err := (*rateLimiter).Check(cost)
+		if err != nil || !allowed {
+			// Give back what the limiters before this one already consumed.
+			for j := i - 1; j >= 0; j-- {
+				(*limiters[j]).refund(cost)
+			}
+			return false, headers, err
+		}
+		result = MostRestrictiveHeaders(result, headers)
+	}
+	return true, result, nil
+}
+
+// MostRestrictiveHeaders picks the headers with the fewest remaining units,
+// preferring the later reset on ties. The longest assigned delay is kept.
+func MostRestrictiveHeaders(current map[string]string, headers map[string]string) map[string]string {
+	if current == nil {
+		return headers
+	}
+	result := current
+	currentRemaining, _ := strconv.ParseFloat(current["X-RateLimit-Remaining"], 64)
+	remaining, _ := strconv.ParseFloat(headers["X-RateLimit-Remaining"], 64)
+	currentReset, _ := strconv.ParseFloat(current["X-RateLimit-Reset"], 64)
+	reset, _ := strconv.ParseFloat(headers["X-RateLimit-Reset"], 64)
+	if remaining < currentRemaining || (remaining == currentRemaining && reset > currentReset) {
+		result = headers
+	}
+	currentDelay, _ := strconv.ParseInt(current[DELAY_HEADER], 10, 64)
+	delay, _ := strconv.ParseInt(headers[DELAY_HEADER], 10, 64)
+	if max(currentDelay, delay) > 0 {
+		result[DELAY_HEADER] = fmt.Sprintf("%d", max(currentDelay, delay))
+	}
+	return result
+}
+
+func (c *CompositeLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (c *CompositeLimiter) refund(cost int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, rateLimiter := range c.limiters {
+		(*rateLimiter).refund(cost)
+	}
+}
+
+func (c *CompositeLimiter) Configure(configuration json.RawMessage) error {
+	err := c.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	err = configureSubLimits(c.key, c.subLimits)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(c.key, COMPOSITE, c)
+}
+
+func (c *CompositeLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Limits []subLimitConfiguration `json:"limits" validate:"required,min=1,dive" message:"limits are required"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+	err = validateSubLimits(configurationData.Limits)
+	if err != nil {
+		return err
+	}
+	c.Limits = len(configurationData.Limits)
+	c.subLimits = configurationData.Limits
+	return nil
+}
+
+// The number of sub-limits may change, so a composite is rebuilt instead. Its
+// sub-limits are reconfigured on their own.
+func (c *CompositeLimiter) reconfigure() bool {
+	return false
+}
+
+func validateSubLimits(limits []subLimitConfiguration) error {
+	for _, limit := range limits {
+		// Leases can't be refunded when another sub-limit denies.
+		if limit.LimiterType == CONCURRENCY {
+			return errors.New("concurrency limits can't be combined with other limits")
+		}
+		// Sub-limits are configured under "<key>#<index>", which can't nest.
+		if limit.LimiterType == COMPOSITE || limit.LimiterType == HIERARCHICAL {
+			return errors.New("composite limits can't be nested")
+		}
+		err := ValidateConfiguration(limit.LimiterType, limit.Configuration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureSubLimits stores each sub-limit under "<key>#<index>" and deletes
+// the ones left from a configuration with more.
+func configureSubLimits(key string, limits []subLimitConfiguration) error {
+	for i, limit := range limits {
+		err := NewLimiter(subLimitKey(key, i), []string{}, limit.LimiterType).Configure(limit.Configuration)
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(limits); ; i++ {
+		if _, err := storage.GetManager().GetConfigureType(subLimitKey(key, i)); err != nil {
+			return nil
+		}
+		if err := deleteConfigKeys(relatedConfigKeys(subLimitKey(key, i))); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *CompositeLimiter) prepareLimiter() error {
+	if err := loadConfiguration(c.key, c); err != nil {
+		return err
+	}
+	c.limiters = make([]*Limiter, 0, c.Limits)
+	for i := range c.Limits {
+		rateLimiter, err := GetManager().AccessLimiter(subLimitKey(c.key, i), c.args)
+		if err != nil {
+			return err
+		}
+		c.limiters = append(c.limiters, rateLimiter)
+	}
+	return nil
+}
+
+// Sub-limits are regular limiters held by the manager, which syncs and
+// replicates them on its own.
+func (c *CompositeLimiter) sync() {}
+
+func (c *CompositeLimiter) publishUpdate() {}
+
+func (c *CompositeLimiter) subscribeUpdates() {}
+
+func (c *CompositeLimiter) isExpired() bool {
+	// Once a sub-limit is dropped by the manager the composite has to be
+	// rebuilt from fresh instances.
+	for _, rateLimiter := range c.limiters {
+		if (*rateLimiter).isExpired() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CompositeLimiter) clear() {}
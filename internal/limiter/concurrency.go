@@ -0,0 +1,146 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"rate-limiting-service/internal/storage"
+	"rate-limiting-service/internal/utils"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// LEASE_HEADER carries the id of the slot acquired by a concurrency limiter,
+// which has to be passed to /release once the request has finished.
+const LEASE_HEADER = "X-RateLimit-Lease"
+
+const DEFAULT_LEASE_TTL_IN_SECS = 60
+
+// ConcurrencyLimiter caps the number of in-flight requests per key. Slots are
+// leases held in storage so they are shared across instances, and leases that
+// are never released are reclaimed once their TTL passes.
+type ConcurrencyLimiter struct {
+	lock          sync.Mutex    `json:"-"`
+	key           string        `json:"-"`
+	args          []string      `json:"-"`
+	lastUsed      time.Time     `json:"-"`
+	MaxConcurrent int           `json:"maxConcurrent"`
+	LeaseTTL      time.Duration `json:"leaseTTL"`
+}
+
+func (c *ConcurrencyLimiter) Check(cost int) (bool, map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lastUsed = time.Now()
+	limiterKey := GetLimiterKey(CONCURRENCY, c.key, c.args)
+	leaseId := utils.RandomString(20)
+	acquired, inFlight, err := storage.GetManager().AcquireLease(limiterKey, leaseId, cost, c.MaxConcurrent, c.LeaseTTL)
+	if err != nil {
+		// Slots are only ever counted in storage, there is nothing to enforce
+		// locally.
+		return false, nil, err
+	}
+
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", c.MaxConcurrent),
+		"X-RateLimit-Remaining": fmt.Sprintf("%d", max(c.MaxConcurrent-inFlight, 0)),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", math.Ceil(c.LeaseTTL.Seconds())),
+	}
+	if acquired {
+		headers[LEASE_HEADER] = leaseId
+	}
+	return acquired, headers, nil
+}
+
+// Release frees the slot held by leaseId.
+func (c *ConcurrencyLimiter) Release(leaseId string) error {
+	limiterKey := GetLimiterKey(CONCURRENCY, c.key, c.args)
+	released, err := storage.GetManager().ReleaseLease(limiterKey, leaseId)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return errors.New("lease not found")
+	}
+	return nil
+}
+
+// Slots are only given back through Release, since refunding needs the lease
+// that was handed out.
+func (c *ConcurrencyLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (c *ConcurrencyLimiter) refund(cost int) {}
+
+func (c *ConcurrencyLimiter) Configure(configuration json.RawMessage) error {
+	err := c.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(c.key, CONCURRENCY, c)
+}
+
+func (c *ConcurrencyLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		MaxConcurrent  int `json:"maxConcurrent" validate:"required,min=1" message:"maxConcurrent must be at least 1"`
+		LeaseTTLInSecs int `json:"leaseTTL" validate:"min=0" message:"leaseTTL in seconds must not be negative"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	c.MaxConcurrent = configurationData.MaxConcurrent
+	if configurationData.LeaseTTLInSecs == 0 {
+		configurationData.LeaseTTLInSecs = DEFAULT_LEASE_TTL_IN_SECS
+	}
+	c.LeaseTTL = time.Second * time.Duration(configurationData.LeaseTTLInSecs)
+	return nil
+}
+
+func (c *ConcurrencyLimiter) reconfigure() bool {
+	configured := &ConcurrencyLimiter{}
+	if err := storage.GetManager().GetConfigureData(c.key, configured); err != nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.MaxConcurrent = configured.MaxConcurrent
+	c.LeaseTTL = configured.LeaseTTL
+	return true
+}
+
+func (c *ConcurrencyLimiter) prepareLimiter() error {
+	if err := loadConfiguration(c.key, c); err != nil {
+		return err
+	}
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// The lease set lives in storage and is updated atomically on every check, so
+// there is no local state to sync or replicate.
+func (c *ConcurrencyLimiter) sync() {}
+
+func (c *ConcurrencyLimiter) publishUpdate() {}
+
+func (c *ConcurrencyLimiter) subscribeUpdates() {}
+
+func (c *ConcurrencyLimiter) isExpired() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return time.Since(c.lastUsed) > c.LeaseTTL*2
+}
+
+func (c *ConcurrencyLimiter) clear() {}
@@ -0,0 +1,144 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"rate-limiting-service/internal/storage"
+	"strconv"
+	"strings"
+)
+
+// Configuration is a key's configuration as it was submitted to /configure.
+type Configuration struct {
+	Key           string          `json:"key"`
+	LimiterType   LimiterType     `json:"limiterType"`
+	Configuration json.RawMessage `json:"configuration"`
+	Consistency   string          `json:"consistency,omitempty"`
+}
+
+// SaveRawConfiguration keeps the submitted configuration next to the parsed
+// one so it can be read back as it was written.
+func SaveRawConfiguration(key string, configuration json.RawMessage) error {
+	return storage.GetManager().SetConfigureField(key, storage.CONFIGURATION_RAW_KEY, string(configuration))
+}
+
+func GetConfiguration(key string) (*Configuration, error) {
+	data, err := storage.GetManager().GetConfigureMap(key)
+	if err != nil {
+		if err.Error() == storage.ErrDataNotFound {
+			return nil, errors.New("key not configured")
+		}
+		return nil, err
+	}
+	limiterType, _ := strconv.Atoi(data[storage.CONFIGURATION_LIMITER_TYPE_KEY])
+	configuration := json.RawMessage(data[storage.CONFIGURATION_RAW_KEY])
+	if len(configuration) == 0 {
+		// Configured before the raw configuration was kept, fall back to the
+		// stored fields.
+		delete(data, storage.CONFIGURATION_LIMITER_TYPE_KEY)
+		delete(data, storage.CONFIGURATION_CONSISTENCY_KEY)
+		configuration, _ = json.Marshal(data)
+	}
+	return &Configuration{
+		Key:           key,
+		LimiterType:   LimiterType(limiterType),
+		Configuration: configuration,
+		Consistency:   data[storage.CONFIGURATION_CONSISTENCY_KEY],
+	}, nil
+}
+
+// ListConfigurations returns a page of the configured keys starting with
+// prefix and the cursor of the next page, 0 once there are no more pages.
+// Sub-limits and overrides are part of their key's configuration and are not
+// listed on their own.
+func ListConfigurations(prefix string, cursor uint64, count int64) ([]Configuration, uint64, error) {
+	keys, nextCursor, err := storage.GetManager().ListConfigureKeys(prefix, cursor, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	configurations := []Configuration{}
+	for _, key := range keys {
+		if isInternalConfigKey(key) {
+			continue
+		}
+		configuration, err := GetConfiguration(key)
+		if err != nil {
+			continue
+		}
+		configurations = append(configurations, *configuration)
+	}
+	return configurations, nextCursor, nil
+}
+
+// DeleteConfiguration removes the configuration of key along with its
+// sub-limits and overrides, drops the live limiters built from them and
+// their stored state.
+func DeleteConfiguration(key string) error {
+	if _, err := GetLimiterTypeForKey(key); err != nil {
+		return err
+	}
+	if err := deleteConfigKeys(relatedConfigKeys(key)); err != nil {
+		return err
+	}
+	publishConfigurationUpdate(key, true)
+	return nil
+}
+
+// deleteConfigKeys drops the live limiters built from the configurations of
+// keys, their stored state and the configurations themselves.
+func deleteConfigKeys(keys []string) error {
+	GetManager().evictLimiters(keys)
+	for _, configKey := range keys {
+		if limiterType, err := GetLimiterTypeForKey(configKey); err == nil {
+			for _, limiterKey := range limiterDataKeys(limiterType, configKey) {
+				if err := storage.GetManager().DeleteLimiterData(limiterKey); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return storage.GetManager().DeleteConfigureData(keys...)
+}
+
+// limiterDataKeys returns every key the limiters of configKey store their
+// state under, for any args.
+func limiterDataKeys(limiterType LimiterType, configKey string) []string {
+	keys := []string{GetLimiterKey(limiterType, configKey, nil), GetStrictLimiterKey(limiterType, configKey, nil)}
+	if limiterType == SLIDING_WINDOW {
+		keys = append(keys, getWindowLogKey(configKey, nil))
+	}
+	return keys
+}
+
+// relatedConfigKeys returns key and the keys of every sub-limit and override
+// configured under it.
+func relatedConfigKeys(key string) []string {
+	keys := []string{key}
+	limiterType, err := GetLimiterTypeForKey(key)
+	if err != nil {
+		return keys
+	}
+	rateLimiter := NewLimiter(key, nil, limiterType)
+	if err := storage.GetManager().GetConfigureData(key, rateLimiter); err != nil {
+		return keys
+	}
+	subLimits := 0
+	switch l := rateLimiter.(type) {
+	case *CompositeLimiter:
+		subLimits = l.Limits
+	case *HierarchicalLimiter:
+		subLimits = l.Levels
+	}
+	for i := range subLimits {
+		keys = append(keys, relatedConfigKeys(subLimitKey(key, i))...)
+	}
+	overrides, _ := GetOverridesForKey(key)
+	for _, override := range overrides {
+		keys = append(keys, relatedConfigKeys(OverrideConfigKey(key, override.Name))...)
+	}
+	return keys
+}
+
+func isInternalConfigKey(key string) bool {
+	return strings.ContainsAny(key, "#@")
+}
@@ -0,0 +1,41 @@
+package limiter
+
+import (
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"strings"
+)
+
+// Eventual limiters decide locally and reconcile with the other instances
+// through updates, which may let a burst overshoot the limit. Strict limiters
+// decide in storage, one atomic round trip per check.
+const (
+	CONSISTENCY_EVENTUAL = "eventual"
+	CONSISTENCY_STRICT   = "strict"
+)
+
+func SupportsStrictConsistency(limiterType LimiterType) bool {
+	return limiterType == TOKEN_BUCKET || limiterType == SLIDING_WINDOW
+}
+
+// SaveConsistency sets the consistency of a configured key, read by its
+// limiters along with the rest of the configuration.
+func SaveConsistency(key string, consistency string) error {
+	if consistency == "" {
+		consistency = CONSISTENCY_EVENTUAL
+	}
+	return storage.GetManager().SetConfigureField(key, storage.CONFIGURATION_CONSISTENCY_KEY, consistency)
+}
+
+// decidesLocally reports whether a strict limiter whose storage failed with err
+// decides on its local state instead. Only the local degraded mode does, while
+// storage can't be reached, every other failure is returned.
+func decidesLocally(err error) bool {
+	return err.Error() == storage.ErrUnavailable && config.DEGRADED_MODE == "local"
+}
+
+// GetStrictLimiterKey returns where a strict limiter keeps its state, apart
+// from the state eventual limiters sync.
+func GetStrictLimiterKey(limiterType LimiterType, key string, args []string) string {
+	return "limiter:strict:" + strings.TrimPrefix(GetLimiterKey(limiterType, key, args), "limiter:")
+}
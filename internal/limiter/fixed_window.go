@@ -0,0 +1,257 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ALIGNMENT_EPOCH         = "epoch"
+	ALIGNMENT_FIRST_REQUEST = "first-request"
+)
+
+type FixedWindowLimiter struct {
+	lock          sync.Mutex           `json:"-"`
+	key           string               `json:"-"`
+	args          []string             `json:"-"`
+	sub           storage.Subscription `json:"-"`
+	syncmap       map[string]int64     `json:"-"`
+	localCount    int64                `json:"-"`
+	refundmap     map[string]int64     `json:"-"`
+	localRefunded int64                `json:"-"`
+	Capacity      int                  `json:"capacity"`
+	WindowSize    time.Duration        `json:"windowSize"`
+	Alignment     string               `json:"alignment"`
+	WindowStart   time.Time            `json:"windowStart"`
+	Count         int                  `json:"count"`
+	Instances     map[string]int64     `json:"instances"`
+	Refunds       map[string]int64     `json:"refunds"`
+	LastUpdated   time.Time            `json:"lastUpdated"`
+}
+
+type fixedWindowUpdate struct {
+	WindowStart int64  `json:"windowStart"`
+	Count       int64  `json:"count"`
+	Refunded    int64  `json:"refunded"`
+	LastUpdated int64  `json:"lastUpdated"`
+	InstanceId  string `json:"instanceId"`
+}
+
+func (f *FixedWindowLimiter) Check(cost int) (bool, map[string]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := time.Now()
+	f.rollWindow(now)
+
+	allowed := f.Count+cost <= f.Capacity
+	if allowed {
+		f.Count += cost
+		f.localCount += int64(cost)
+		go f.publishUpdate()
+	}
+	f.LastUpdated = now
+
+	remaining := max(f.Capacity-f.Count, 0)
+	reset := f.WindowStart.Add(f.WindowSize).Sub(now).Seconds()
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", f.Capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%d", remaining),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", reset),
+	}
+	return allowed, headers, nil
+}
+
+func (f *FixedWindowLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (f *FixedWindowLimiter) refund(cost int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.Count = max(f.Count-cost, 0)
+	f.localRefunded += int64(cost)
+	f.LastUpdated = time.Now()
+	go f.publishUpdate()
+}
+
+// rollWindow moves the limiter into the window containing now, resetting the
+// counters when the previous window has ended.
+func (f *FixedWindowLimiter) rollWindow(now time.Time) {
+	var windowStart time.Time
+	if f.Alignment == ALIGNMENT_FIRST_REQUEST {
+		if !f.WindowStart.IsZero() && now.Before(f.WindowStart.Add(f.WindowSize)) {
+			return
+		}
+		windowStart = now
+	} else {
+		windowStart = time.Unix(0, now.UnixNano()-now.UnixNano()%int64(f.WindowSize))
+	}
+	if windowStart.Equal(f.WindowStart) {
+		return
+	}
+	f.WindowStart = windowStart
+	f.Count = 0
+	f.localCount = 0
+	f.localRefunded = 0
+	f.syncmap = map[string]int64{}
+	f.refundmap = map[string]int64{}
+}
+
+func (f *FixedWindowLimiter) Configure(configuration json.RawMessage) error {
+	err := f.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(f.key, FIXED_WINDOW, f)
+}
+
+func (f *FixedWindowLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Capacity         int    `json:"capacity" validate:"required,min=1" message:"capacity must be at least 1"`
+		WindowSizeInSecs int    `json:"windowSize" validate:"required,min=1" message:"windowSize in seconds must be at least 1"`
+		Alignment        string `json:"alignment" validate:"omitempty,oneof=epoch first-request" message:"alignment must be epoch or first-request"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	f.Capacity = configurationData.Capacity
+	f.WindowSize = time.Second * time.Duration(configurationData.WindowSizeInSecs)
+	f.Alignment = configurationData.Alignment
+	if f.Alignment == "" {
+		f.Alignment = ALIGNMENT_EPOCH
+	}
+	f.Count = 0
+	f.LastUpdated = time.Now()
+	return nil
+}
+
+func (f *FixedWindowLimiter) reconfigure() bool {
+	configured := &FixedWindowLimiter{}
+	if err := storage.GetManager().GetConfigureData(f.key, configured); err != nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.Capacity = configured.Capacity
+	f.WindowSize = configured.WindowSize
+	f.Alignment = configured.Alignment
+	return true
+}
+
+func (f *FixedWindowLimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(FIXED_WINDOW, f.key, f.args)
+	if err := loadLimiterState(limiterKey, f.key, f); err != nil {
+		return err
+	}
+	f.syncmap, f.localCount = seedInstanceCounts(f.Instances)
+	f.refundmap, f.localRefunded = seedInstanceCounts(f.Refunds)
+	return nil
+}
+
+func (f *FixedWindowLimiter) sync() {
+	f.lock.Lock()
+	state := &FixedWindowLimiter{
+		Capacity:    f.Capacity,
+		WindowSize:  f.WindowSize,
+		Alignment:   f.Alignment,
+		WindowStart: f.WindowStart,
+		Count:       f.Count,
+		Instances:   instanceCounts(f.syncmap, f.localCount),
+		Refunds:     instanceCounts(f.refundmap, f.localRefunded),
+		LastUpdated: f.LastUpdated,
+	}
+	f.lock.Unlock()
+	limiterKey := GetLimiterKey(FIXED_WINDOW, f.key, f.args)
+	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
+	if previouslastUpdated != "" {
+		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
+		if previouslastUpdatedTime.UnixNano() >= state.LastUpdated.UnixNano() {
+			return
+		}
+	}
+	ttlSeconds := int(state.WindowSize)/int(time.Second)*2 + 2
+	storage.GetManager().SetLimiterData(limiterKey, state, ttlSeconds)
+}
+
+func (f *FixedWindowLimiter) isExpired() bool {
+	return time.Since(f.LastUpdated) > f.WindowSize*2
+}
+
+func (f *FixedWindowLimiter) publishUpdate() {
+	f.lock.Lock()
+	update := fixedWindowUpdate{
+		WindowStart: f.WindowStart.UnixNano(),
+		Count:       f.localCount,
+		Refunded:    f.localRefunded,
+		LastUpdated: f.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	f.lock.Unlock()
+	updatesKey := GetUpdatesKey(FIXED_WINDOW, f.key, f.args)
+	jsonData, _ := json.Marshal(update)
+	storage.GetManager().PublishUpdates(updatesKey, jsonData)
+}
+
+func (f *FixedWindowLimiter) subscribeUpdates() {
+	updatesKey := GetUpdatesKey(FIXED_WINDOW, f.key, f.args)
+	f.sub = storage.GetManager().SubscribeUpdates(updatesKey)
+	ch := f.sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update fixedWindowUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			windowStart := time.Unix(0, update.WindowStart)
+			f.lock.Lock()
+			// Another instance may have opened a newer window first (e.g. with
+			// first-request alignment); adopt it while it is still running.
+			if windowStart.After(f.WindowStart) && time.Now().Before(windowStart.Add(f.WindowSize)) {
+				f.WindowStart = windowStart
+				f.Count = 0
+				f.localCount = 0
+				f.localRefunded = 0
+				f.syncmap = map[string]int64{}
+				f.refundmap = map[string]int64{}
+			}
+			if windowStart.Equal(f.WindowStart) {
+				// Counts are cumulative per instance and only grow, so only what
+				// is new is applied and updates arriving out of order are ignored.
+				if taken := update.Count - f.syncmap[update.InstanceId]; taken > 0 {
+					f.Count += int(taken)
+					f.syncmap[update.InstanceId] = update.Count
+				}
+				if refunded := update.Refunded - f.refundmap[update.InstanceId]; refunded > 0 {
+					f.Count = max(f.Count-int(refunded), 0)
+					f.refundmap[update.InstanceId] = update.Refunded
+				}
+				if update.LastUpdated > f.LastUpdated.UnixNano() {
+					f.LastUpdated = time.Unix(0, update.LastUpdated)
+				}
+			}
+			f.lock.Unlock()
+		}
+	}()
+}
+
+func (f *FixedWindowLimiter) clear() {
+	f.sub.Close()
+}
@@ -0,0 +1,215 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// GCRALimiter implements the generic cell rate algorithm. The only state kept
+// per key is the theoretical arrival time (TAT) of the next request.
+type GCRALimiter struct {
+	lock        sync.Mutex           `json:"-"`
+	key         string               `json:"-"`
+	args        []string             `json:"-"`
+	sub         storage.Subscription `json:"-"`
+	Rate        int                  `json:"rate"`
+	Period      time.Duration        `json:"period"`
+	Burst       int                  `json:"burst"`
+	TAT         time.Time            `json:"tat"`
+	LastUpdated time.Time            `json:"lastUpdated"`
+}
+
+// gcraUpdate carries the TAT of a peer, or how far a refund moved it back.
+type gcraUpdate struct {
+	TAT         int64  `json:"tat"`
+	Refunded    int64  `json:"refunded"`
+	LastUpdated int64  `json:"lastUpdated"`
+	InstanceId  string `json:"instanceId"`
+}
+
+func (g *GCRALimiter) Check(cost int) (bool, map[string]string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := time.Now()
+	interval := g.emissionInterval()
+	tolerance := interval * time.Duration(g.Burst)
+
+	tat := g.TAT
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval * time.Duration(cost))
+	allowAt := newTat.Add(-tolerance)
+
+	headers := map[string]string{
+		"X-RateLimit-Limit": fmt.Sprintf("%d", g.Burst),
+	}
+	if now.Before(allowAt) {
+		remaining := math.Floor(float64(tolerance-tat.Sub(now)) / float64(interval))
+		headers["X-RateLimit-Remaining"] = fmt.Sprintf("%.0f", max(remaining, 0))
+		headers["X-RateLimit-Reset"] = fmt.Sprintf("%.0f", math.Ceil(tat.Sub(now).Seconds()))
+		headers["Retry-After"] = fmt.Sprintf("%.0f", math.Ceil(allowAt.Sub(now).Seconds()))
+		return false, headers, nil
+	}
+
+	g.TAT = newTat
+	g.LastUpdated = now
+	go g.publishUpdate()
+	remaining := math.Floor(float64(tolerance-newTat.Sub(now)) / float64(interval))
+	headers["X-RateLimit-Remaining"] = fmt.Sprintf("%.0f", max(remaining, 0))
+	headers["X-RateLimit-Reset"] = fmt.Sprintf("%.0f", math.Ceil(newTat.Sub(now).Seconds()))
+	return true, headers, nil
+}
+
+func (g *GCRALimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (g *GCRALimiter) refund(cost int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	refunded := g.emissionInterval() * time.Duration(cost)
+	g.TAT = g.TAT.Add(-refunded)
+	g.LastUpdated = time.Now()
+	go g.publishRefund(refunded)
+}
+
+// emissionInterval is the time it takes to earn back a single request.
+func (g *GCRALimiter) emissionInterval() time.Duration {
+	return g.Period / time.Duration(g.Rate)
+}
+
+func (g *GCRALimiter) Configure(configuration json.RawMessage) error {
+	err := g.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(g.key, GCRA, g)
+}
+
+func (g *GCRALimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Rate         int `json:"rate" validate:"required,min=1" message:"rate must be at least 1"`
+		PeriodInSecs int `json:"period" validate:"required,min=1" message:"period in seconds must be at least 1"`
+		Burst        int `json:"burst" validate:"required,min=1" message:"burst must be at least 1"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	g.Rate = configurationData.Rate
+	g.Period = time.Second * time.Duration(configurationData.PeriodInSecs)
+	g.Burst = configurationData.Burst
+	return nil
+}
+
+func (g *GCRALimiter) reconfigure() bool {
+	configured := &GCRALimiter{}
+	if err := storage.GetManager().GetConfigureData(g.key, configured); err != nil {
+		return false
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.Rate = configured.Rate
+	g.Period = configured.Period
+	g.Burst = configured.Burst
+	return true
+}
+
+func (g *GCRALimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(GCRA, g.key, g.args)
+	return loadLimiterState(limiterKey, g.key, g)
+}
+
+func (g *GCRALimiter) sync() {
+	g.lock.Lock()
+	state := &GCRALimiter{Rate: g.Rate, Period: g.Period, Burst: g.Burst, TAT: g.TAT, LastUpdated: g.LastUpdated}
+	g.lock.Unlock()
+	limiterKey := GetLimiterKey(GCRA, g.key, g.args)
+	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
+	if previouslastUpdated != "" {
+		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
+		if previouslastUpdatedTime.UnixNano() >= state.LastUpdated.UnixNano() {
+			return
+		}
+	}
+	ttlSeconds := int(math.Ceil(time.Until(state.TAT).Seconds())) + 2
+	storage.GetManager().SetLimiterData(limiterKey, state, ttlSeconds)
+}
+
+func (g *GCRALimiter) isExpired() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	// Once the TAT has passed the limiter is indistinguishable from a fresh one.
+	return time.Now().After(g.TAT.Add(2 * time.Second))
+}
+
+func (g *GCRALimiter) publishUpdate() {
+	g.publish(0)
+}
+
+// publishRefund tells the peers how far a refund moved the TAT back, as they
+// keep the latest TAT they know of.
+func (g *GCRALimiter) publishRefund(refunded time.Duration) {
+	g.publish(refunded)
+}
+
+func (g *GCRALimiter) publish(refunded time.Duration) {
+	g.lock.Lock()
+	update := gcraUpdate{
+		TAT:         g.TAT.UnixNano(),
+		Refunded:    int64(refunded),
+		LastUpdated: g.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	g.lock.Unlock()
+	updatesKey := GetUpdatesKey(GCRA, g.key, g.args)
+	jsonData, _ := json.Marshal(update)
+	storage.GetManager().PublishUpdates(updatesKey, jsonData)
+}
+
+func (g *GCRALimiter) subscribeUpdates() {
+	updatesKey := GetUpdatesKey(GCRA, g.key, g.args)
+	g.sub = storage.GetManager().SubscribeUpdates(updatesKey)
+	ch := g.sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update gcraUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			g.lock.Lock()
+			if update.Refunded > 0 {
+				g.TAT = g.TAT.Add(-time.Duration(update.Refunded))
+			} else if update.TAT > g.TAT.UnixNano() {
+				g.TAT = time.Unix(0, update.TAT)
+			}
+			if update.LastUpdated > g.LastUpdated.UnixNano() {
+				g.LastUpdated = time.Unix(0, update.LastUpdated)
+			}
+			g.lock.Unlock()
+		}
+	}()
+}
+
+func (g *GCRALimiter) clear() {
+	g.sub.Close()
+}
@@ -0,0 +1,119 @@
+package limiter
+
+import (
+	"encoding/json"
+	"rate-limiting-service/internal/storage"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// HierarchicalLimiter applies one limit per prefix of args, e.g. a global
+// limit, a limit per tenant (args[0]) and a limit per user within the tenant
+// (args[0], args[1]). A check passes only if every level has capacity, and is
+// then charged to all of them. Level i is configured under "<key>#<i>" and
+// limits args[:i].
+type HierarchicalLimiter struct {
+	lock      sync.Mutex              `json:"-"`
+	key       string                  `json:"-"`
+	args      []string                `json:"-"`
+	limiters  []*Limiter              `json:"-"`
+	subLimits []subLimitConfiguration `json:"-"`
+	Levels    int                     `json:"levels"`
+}
+
+func (h *HierarchicalLimiter) Check(cost int) (bool, map[string]string, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return checkAll(h.limiters, cost)
+}
+
+func (h *HierarchicalLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (h *HierarchicalLimiter) refund(cost int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, rateLimiter := range h.limiters {
+		(*rateLimiter).refund(cost)
+	}
+}
+
+func (h *HierarchicalLimiter) Configure(configuration json.RawMessage) error {
+	err := h.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	err = configureSubLimits(h.key, h.subLimits)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(h.key, HIERARCHICAL, h)
+}
+
+func (h *HierarchicalLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Levels []subLimitConfiguration `json:"levels" validate:"required,min=1,dive" message:"levels are required"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+	err = validateSubLimits(configurationData.Levels)
+	if err != nil {
+		return err
+	}
+	h.Levels = len(configurationData.Levels)
+	h.subLimits = configurationData.Levels
+	return nil
+}
+
+// The number of levels may change, so the limiter is rebuilt instead. Its
+// levels are reconfigured on their own.
+func (h *HierarchicalLimiter) reconfigure() bool {
+	return false
+}
+
+func (h *HierarchicalLimiter) prepareLimiter() error {
+	if err := loadConfiguration(h.key, h); err != nil {
+		return err
+	}
+	// Levels deeper than the args given are skipped. Each level is shared by
+	// every check with the same args prefix through the manager.
+	levels := min(h.Levels, len(h.args)+1)
+	h.limiters = make([]*Limiter, 0, levels)
+	for i := range levels {
+		rateLimiter, err := GetManager().AccessLimiter(subLimitKey(h.key, i), h.args[:i])
+		if err != nil {
+			return err
+		}
+		h.limiters = append(h.limiters, rateLimiter)
+	}
+	return nil
+}
+
+// Levels are regular limiters held by the manager, which syncs and replicates
+// them on its own.
+func (h *HierarchicalLimiter) sync() {}
+
+func (h *HierarchicalLimiter) publishUpdate() {}
+
+func (h *HierarchicalLimiter) subscribeUpdates() {}
+
+func (h *HierarchicalLimiter) isExpired() bool {
+	for _, rateLimiter := range h.limiters {
+		if (*rateLimiter).isExpired() {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HierarchicalLimiter) clear() {}
@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"rate-limiting-service/internal/storage"
+	"time"
+)
+
+// ConfigurationVersion is an immutable record of a write to a key's
+// configuration. Versions are numbered from 1 in the order they were made.
+type ConfigurationVersion struct {
+	Version       int64                          `json:"version"`
+	Timestamp     time.Time                      `json:"timestamp"`
+	Author        string                         `json:"author"`
+	LimiterType   LimiterType                    `json:"limiterType"`
+	Configuration json.RawMessage                `json:"configuration,omitempty"`
+	Consistency   string                         `json:"consistency,omitempty"`
+	Deleted       bool                           `json:"deleted,omitempty"`
+	Diff          map[string]ConfigurationChange `json:"diff"`
+}
+
+// ConfigurationChange is the value of a configuration field before and after
+// a write, nil where the field was missing.
+type ConfigurationChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// RecordConfigurationVersion adds a version to the history of key for a
+// write replacing previous, nil if the key wasn't configured. A nil current
+// records the deletion of the key.
+func RecordConfigurationVersion(key string, author string, previous *Configuration, current *Configuration) (int64, error) {
+	version := ConfigurationVersion{
+		Timestamp: time.Now(),
+		Author:    author,
+		Diff:      diffConfigurations(previous, current),
+	}
+	if current != nil {
+		version.LimiterType = current.LimiterType
+		version.Configuration = current.Configuration
+		version.Consistency = current.Consistency
+	} else {
+		version.Deleted = true
+		if previous != nil {
+			version.LimiterType = previous.LimiterType
+		}
+	}
+	jsonData, _ := json.Marshal(version)
+	return storage.GetManager().AppendConfigureHistory(key, jsonData)
+}
+
+func GetConfigurationHistory(key string) ([]ConfigurationVersion, error) {
+	data, err := storage.GetManager().GetConfigureHistory(key)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]ConfigurationVersion, 0, len(data))
+	for i, value := range data {
+		var version ConfigurationVersion
+		if err := json.Unmarshal([]byte(value), &version); err != nil {
+			return nil, err
+		}
+		version.Version = int64(i + 1)
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func GetConfigurationVersion(key string, number int64) (*ConfigurationVersion, error) {
+	if number < 1 {
+		return nil, errors.New("version not found")
+	}
+	data, err := storage.GetManager().GetConfigureVersion(key, number)
+	if err != nil {
+		if err.Error() == storage.ErrDataNotFound {
+			return nil, errors.New("version not found")
+		}
+		return nil, err
+	}
+	var version ConfigurationVersion
+	if err := json.Unmarshal([]byte(data), &version); err != nil {
+		return nil, err
+	}
+	version.Version = number
+	return &version, nil
+}
+
+// diffConfigurations compares the top-level fields of two configurations,
+// along with their limiter types and consistency.
+func diffConfigurations(previous *Configuration, current *Configuration) map[string]ConfigurationChange {
+	fields := func(configuration *Configuration) map[string]any {
+		values := map[string]any{}
+		if configuration == nil {
+			return values
+		}
+		json.Unmarshal(configuration.Configuration, &values)
+		values["limiterType"] = configuration.LimiterType
+		if configuration.Consistency != "" {
+			values["consistency"] = configuration.Consistency
+		}
+		return values
+	}
+	before := fields(previous)
+	after := fields(current)
+	diff := map[string]ConfigurationChange{}
+	for field, value := range after {
+		if !sameValue(before[field], value) {
+			diff[field] = ConfigurationChange{From: before[field], To: value}
+		}
+	}
+	for field, value := range before {
+		if _, exists := after[field]; !exists {
+			diff[field] = ConfigurationChange{From: value}
+		}
+	}
+	return diff
+}
+
+func sameValue(a any, b any) bool {
+	jsonA, _ := json.Marshal(a)
+	jsonB, _ := json.Marshal(b)
+	return string(jsonA) == string(jsonB)
+}
@@ -0,0 +1,212 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DELAY_HEADER carries the number of milliseconds a caller should wait before
+// proceeding with a request that was queued by a leaky bucket.
+const DELAY_HEADER = "X-RateLimit-Delay"
+
+// LeakyBucketLimiter works as a queue: requests above the leak rate are not
+// rejected but given a delay, and only rejected once the queue is full.
+type LeakyBucketLimiter struct {
+	lock        sync.Mutex           `json:"-"`
+	key         string               `json:"-"`
+	args        []string             `json:"-"`
+	sub         storage.Subscription `json:"-"`
+	LeakRate    float64              `json:"leakRate"`
+	QueueDepth  int                  `json:"queueDepth"`
+	NextFree    time.Time            `json:"nextFree"`
+	LastUpdated time.Time            `json:"lastUpdated"`
+}
+
+// leakyBucketUpdate carries the next free slot of a peer, or how far a refund
+// moved it back.
+type leakyBucketUpdate struct {
+	NextFree    int64  `json:"nextFree"`
+	Refunded    int64  `json:"refunded"`
+	LastUpdated int64  `json:"lastUpdated"`
+	InstanceId  string `json:"instanceId"`
+}
+
+func (l *LeakyBucketLimiter) Check(cost int) (bool, map[string]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	interval := time.Duration(float64(time.Second) / l.LeakRate)
+	start := l.NextFree
+	if start.Before(now) {
+		start = now
+	}
+	delay := start.Sub(now)
+	// The first unit leaks as soon as the request starts, the rest wait in
+	// the queue behind it.
+	queued := int(math.Round(delay.Seconds()*l.LeakRate)) + cost - 1
+
+	headers := map[string]string{
+		"X-RateLimit-Limit": fmt.Sprintf("%d", l.QueueDepth),
+	}
+	if queued > l.QueueDepth {
+		retryAfter := start.Add(-time.Duration(l.QueueDepth) * interval).Sub(now)
+		headers["X-RateLimit-Remaining"] = "0"
+		headers["X-RateLimit-Reset"] = fmt.Sprintf("%.0f", math.Ceil(delay.Seconds()))
+		headers["Retry-After"] = fmt.Sprintf("%.0f", math.Ceil(retryAfter.Seconds()))
+		return false, headers, nil
+	}
+
+	l.NextFree = start.Add(interval * time.Duration(cost))
+	l.LastUpdated = now
+	go l.publishUpdate()
+	headers["X-RateLimit-Remaining"] = fmt.Sprintf("%d", l.QueueDepth-queued)
+	headers["X-RateLimit-Reset"] = fmt.Sprintf("%.0f", math.Ceil(l.NextFree.Sub(now).Seconds()))
+	headers[DELAY_HEADER] = fmt.Sprintf("%d", delay.Milliseconds())
+	return true, headers, nil
+}
+
+func (l *LeakyBucketLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (l *LeakyBucketLimiter) refund(cost int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	interval := time.Duration(float64(time.Second) / l.LeakRate)
+	refunded := interval * time.Duration(cost)
+	l.NextFree = l.NextFree.Add(-refunded)
+	l.LastUpdated = time.Now()
+	go l.publishRefund(refunded)
+}
+
+func (l *LeakyBucketLimiter) Configure(configuration json.RawMessage) error {
+	err := l.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(l.key, LEAKY_BUCKET, l)
+}
+
+func (l *LeakyBucketLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		LeakRate   float64 `json:"leakRate" validate:"required,gt=0" message:"leakRate must be positive"`
+		QueueDepth int     `json:"queueDepth" validate:"min=0" message:"queueDepth must not be negative"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	l.LeakRate = configurationData.LeakRate
+	l.QueueDepth = configurationData.QueueDepth
+	return nil
+}
+
+func (l *LeakyBucketLimiter) reconfigure() bool {
+	configured := &LeakyBucketLimiter{}
+	if err := storage.GetManager().GetConfigureData(l.key, configured); err != nil {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.LeakRate = configured.LeakRate
+	l.QueueDepth = configured.QueueDepth
+	return true
+}
+
+func (l *LeakyBucketLimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(LEAKY_BUCKET, l.key, l.args)
+	return loadLimiterState(limiterKey, l.key, l)
+}
+
+func (l *LeakyBucketLimiter) sync() {
+	l.lock.Lock()
+	state := &LeakyBucketLimiter{LeakRate: l.LeakRate, QueueDepth: l.QueueDepth, NextFree: l.NextFree, LastUpdated: l.LastUpdated}
+	l.lock.Unlock()
+	limiterKey := GetLimiterKey(LEAKY_BUCKET, l.key, l.args)
+	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
+	if previouslastUpdated != "" {
+		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
+		if previouslastUpdatedTime.UnixNano() >= state.LastUpdated.UnixNano() {
+			return
+		}
+	}
+	ttlSeconds := int(math.Ceil(time.Until(state.NextFree).Seconds())) + 2
+	storage.GetManager().SetLimiterData(limiterKey, state, ttlSeconds)
+}
+
+func (l *LeakyBucketLimiter) isExpired() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// An empty queue is indistinguishable from a fresh limiter.
+	return time.Now().After(l.NextFree.Add(2 * time.Second))
+}
+
+func (l *LeakyBucketLimiter) publishUpdate() {
+	l.publish(0)
+}
+
+// publishRefund tells the peers how far a refund moved the next free slot
+// back, as they keep the latest one they know of.
+func (l *LeakyBucketLimiter) publishRefund(refunded time.Duration) {
+	l.publish(refunded)
+}
+
+func (l *LeakyBucketLimiter) publish(refunded time.Duration) {
+	l.lock.Lock()
+	update := leakyBucketUpdate{
+		NextFree:    l.NextFree.UnixNano(),
+		Refunded:    int64(refunded),
+		LastUpdated: l.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	l.lock.Unlock()
+	updatesKey := GetUpdatesKey(LEAKY_BUCKET, l.key, l.args)
+	jsonData, _ := json.Marshal(update)
+	storage.GetManager().PublishUpdates(updatesKey, jsonData)
+}
+
+func (l *LeakyBucketLimiter) subscribeUpdates() {
+	updatesKey := GetUpdatesKey(LEAKY_BUCKET, l.key, l.args)
+	l.sub = storage.GetManager().SubscribeUpdates(updatesKey)
+	ch := l.sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update leakyBucketUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			l.lock.Lock()
+			if update.Refunded > 0 {
+				l.NextFree = l.NextFree.Add(-time.Duration(update.Refunded))
+			} else if update.NextFree > l.NextFree.UnixNano() {
+				l.NextFree = time.Unix(0, update.NextFree)
+			}
+			if update.LastUpdated > l.LastUpdated.UnixNano() {
+				l.LastUpdated = time.Unix(0, update.LastUpdated)
+			}
+			l.lock.Unlock()
+		}
+	}()
+}
+
+func (l *LeakyBucketLimiter) clear() {
+	l.sub.Close()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/storage"
 	"strings"
 	"sync"
@@ -12,14 +13,28 @@ import (
 type LimiterType int
 
 const (
-	TOKEN_BUCKET   = 10
-	SLIDING_WINDOW = 20
+	TOKEN_BUCKET           = 10
+	SLIDING_WINDOW         = 20
+	FIXED_WINDOW           = 30
+	SLIDING_WINDOW_COUNTER = 40
+	GCRA                   = 50
+	LEAKY_BUCKET           = 60
+	CONCURRENCY            = 70
+	QUOTA                  = 80
+	COMPOSITE              = 90
+	HIERARCHICAL           = 100
 )
 
 type Limiter interface {
-	Check() (bool, map[string]string)
+	Check(cost int) (bool, map[string]string, error)
+	// Peek reports whether a check of cost would be allowed, along with the
+	// headers it would return, without taking anything.
+	Peek(cost int) (bool, map[string]string, error)
 	Configure(json.RawMessage) error
-	prepareLimiter()
+	parseConfiguration(json.RawMessage) error
+	prepareLimiter() error
+	reconfigure() bool
+	refund(cost int)
 	sync()
 	publishUpdate()
 	subscribeUpdates()
@@ -27,6 +42,10 @@ type Limiter interface {
 	clear()
 }
 
+// errPeekNotSupported is returned by the limiters that can't tell whether a
+// check would be allowed without making it.
+var errPeekNotSupported = errors.New("rate limiter does not support peek")
+
 func NewLimiter(key string, args []string, limiterType LimiterType) Limiter {
 	switch limiterType {
 	case TOKEN_BUCKET:
@@ -41,34 +60,187 @@ func NewLimiter(key string, args []string, limiterType LimiterType) Limiter {
 			key:  key,
 			args: args,
 		}
+	case FIXED_WINDOW:
+		return &FixedWindowLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case SLIDING_WINDOW_COUNTER:
+		return &SlidingWindowCounterLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case GCRA:
+		return &GCRALimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case LEAKY_BUCKET:
+		return &LeakyBucketLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case CONCURRENCY:
+		return &ConcurrencyLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case QUOTA:
+		return &QuotaLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case COMPOSITE:
+		return &CompositeLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
+	case HIERARCHICAL:
+		return &HierarchicalLimiter{
+			lock: sync.Mutex{},
+			key:  key,
+			args: args,
+		}
 	}
 	panic("unknown limiter type")
 }
 
+// ValidateConfiguration checks a configuration the way Configure does,
+// without storing it.
+func ValidateConfiguration(limiterType LimiterType, configuration json.RawMessage) error {
+	if !IsValidLimiterType(limiterType) {
+		return errors.New("unknown limiter type")
+	}
+	return NewLimiter("", []string{}, limiterType).parseConfiguration(configuration)
+}
+
+func IsValidLimiterType(limiterType LimiterType) bool {
+	switch limiterType {
+	case TOKEN_BUCKET, SLIDING_WINDOW, FIXED_WINDOW, SLIDING_WINDOW_COUNTER,
+		GCRA, LEAKY_BUCKET, CONCURRENCY, QUOTA, COMPOSITE, HIERARCHICAL:
+		return true
+	}
+	return false
+}
+
+// Refund gives back the cost taken by a check of rateLimiter that was allowed
+// with headers. Concurrency limiters release the lease it acquired instead.
+func Refund(rateLimiter *Limiter, cost int, headers map[string]string) error {
+	if concurrencyLimiter, ok := (*rateLimiter).(*ConcurrencyLimiter); ok {
+		return concurrencyLimiter.Release(headers[LEASE_HEADER])
+	}
+	(*rateLimiter).refund(cost)
+	return nil
+}
+
 var KeyLimiterTypeMap = map[string]LimiterType{}
 
+// keyCacheLock guards KeyLimiterTypeMap and KeyOverridesMap, which are also
+// invalidated by configuration updates from other instances.
+var keyCacheLock sync.RWMutex
+
 func GetLimiterTypeForKey(key string) (LimiterType, error) {
-	if limiterType, exists := KeyLimiterTypeMap[key]; exists {
+	keyCacheLock.RLock()
+	limiterType, exists := KeyLimiterTypeMap[key]
+	keyCacheLock.RUnlock()
+	if exists {
 		return limiterType, nil
 	}
 	ltype, err := storage.GetManager().GetConfigureType(key)
 	if err == nil {
+		keyCacheLock.Lock()
 		KeyLimiterTypeMap[key] = LimiterType(ltype)
+		keyCacheLock.Unlock()
 		return LimiterType(ltype), nil
 	}
 	if err.Error() == storage.ErrDataNotFound {
 		return -1, errors.New("key not configured")
 	}
-	panic(err)
+	return -1, err
+}
+
+// loadLimiterState reads the state stored at limiterKey into out, or the
+// configuration of key for a limiter with no state yet. While storage can't be
+// reached the limiter starts over from the configuration last read of key and
+// enforces locally.
+func loadLimiterState(limiterKey string, key string, out any) error {
+	err := storage.GetManager().GetLimiterData(limiterKey, out)
+	if err == nil {
+		return nil
+	}
+	if err.Error() != storage.ErrDataNotFound && err.Error() != storage.ErrUnavailable {
+		return err
+	}
+	return loadConfiguration(key, out)
+}
+
+func loadConfiguration(key string, out any) error {
+	err := storage.GetManager().GetConfigureData(key, out)
+	if err != nil && err.Error() == storage.ErrDataNotFound {
+		return errors.New("rate limiter not configured")
+	}
+	return err
+}
+
+// seedInstanceCounts splits the per instance counts stored with a shared
+// counter into what this instance counted itself and what the updates of each
+// peer already added, so those aren't counted again.
+func seedInstanceCounts(instances map[string]int64) (map[string]int64, int64) {
+	syncmap := map[string]int64{}
+	for instanceId, count := range instances {
+		syncmap[instanceId] = count
+	}
+	localCount := syncmap[config.RATE_LIMITING_INSTANCE_ID]
+	delete(syncmap, config.RATE_LIMITING_INSTANCE_ID)
+	return syncmap, localCount
+}
+
+// instanceCounts returns what every instance, this one included, added to a
+// shared counter, to be stored along with it.
+func instanceCounts(syncmap map[string]int64, localCount int64) map[string]int64 {
+	instances := map[string]int64{}
+	for instanceId, count := range syncmap {
+		instances[instanceId] = count
+	}
+	if localCount > 0 {
+		instances[config.RATE_LIMITING_INSTANCE_ID] = localCount
+	}
+	return instances
 }
 
+// GetLimiterKey returns where the limiter of key for args stores its state.
+// In a Redis Cluster every args of a key share the slot of the key.
 func GetLimiterKey(limType LimiterType, key string, args []string) string {
+	key = storage.HashTag(key)
 	var limiterKey string
 	switch limType {
 	case TOKEN_BUCKET:
 		limiterKey = fmt.Sprintf("limiter:tbl:%s", key)
 	case SLIDING_WINDOW:
 		limiterKey = fmt.Sprintf("limiter:sw:%s", key)
+	case FIXED_WINDOW:
+		limiterKey = fmt.Sprintf("limiter:fw:%s", key)
+	case SLIDING_WINDOW_COUNTER:
+		limiterKey = fmt.Sprintf("limiter:swc:%s", key)
+	case GCRA:
+		limiterKey = fmt.Sprintf("limiter:gcra:%s", key)
+	case LEAKY_BUCKET:
+		limiterKey = fmt.Sprintf("limiter:lb:%s", key)
+	case CONCURRENCY:
+		limiterKey = fmt.Sprintf("limiter:cc:%s", key)
+	case QUOTA:
+		limiterKey = fmt.Sprintf("limiter:quota:%s", key)
+	case COMPOSITE:
+		limiterKey = fmt.Sprintf("limiter:comp:%s", key)
+	case HIERARCHICAL:
+		limiterKey = fmt.Sprintf("limiter:hier:%s", key)
 	}
 	if len(args) > 0 {
 		limiterKey = fmt.Sprintf("%s:%s", limiterKey, strings.Join(args, ":"))
@@ -77,12 +249,25 @@ func GetLimiterKey(limType LimiterType, key string, args []string) string {
 }
 
 func GetUpdatesKey(limType LimiterType, key string, args []string) string {
+	key = storage.HashTag(key)
 	var limiterKey string
 	switch limType {
 	case TOKEN_BUCKET:
 		limiterKey = fmt.Sprintf("updates:tbl:%s", key)
 	case SLIDING_WINDOW:
 		limiterKey = fmt.Sprintf("updates:sw:%s", key)
+	case FIXED_WINDOW:
+		limiterKey = fmt.Sprintf("updates:fw:%s", key)
+	case SLIDING_WINDOW_COUNTER:
+		limiterKey = fmt.Sprintf("updates:swc:%s", key)
+	case GCRA:
+		limiterKey = fmt.Sprintf("updates:gcra:%s", key)
+	case LEAKY_BUCKET:
+		limiterKey = fmt.Sprintf("updates:lb:%s", key)
+	case CONCURRENCY:
+		limiterKey = fmt.Sprintf("updates:cc:%s", key)
+	case QUOTA:
+		limiterKey = fmt.Sprintf("updates:quota:%s", key)
 	}
 	if len(args) > 0 {
 		limiterKey = fmt.Sprintf("%s:%s", limiterKey, strings.Join(args, ":"))
@@ -2,19 +2,23 @@ package limiter
 
 import (
 	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
 	"sync"
 	"time"
 )
 
 type limiterInstance struct {
-	Limiter  *Limiter
-	LastUsed time.Time
+	Limiter     *Limiter
+	LastUsed    time.Time
+	ConfigKey   string
+	LimiterType LimiterType
 }
 
 type manager struct {
-	limiters   map[string]*limiterInstance
-	lastSynced time.Time
-	lock       *sync.Mutex
+	limiters         map[string]*limiterInstance
+	lastSynced       time.Time
+	lock             *sync.Mutex
+	configureUpdates storage.Subscription
 }
 
 var instance *manager
@@ -29,29 +33,46 @@ func GetManager() *manager {
 	return instance
 }
 
-func (m *manager) AccessLimiter(key string, args []string) *Limiter {
+// AccessLimiter returns the live limiter of key for args, building it from
+// the stored state and configuration the first time.
+func (m *manager) AccessLimiter(key string, args []string) (*Limiter, error) {
+	// Args matching an override are limited by the override's configuration.
+	key, err := resolveConfigKey(key, args)
+	if err != nil {
+		return nil, err
+	}
 	limiterType, err := GetLimiterTypeForKey(key)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	limiterKey := GetLimiterKey(limiterType, key, args)
-	if instance, exists := m.limiters[limiterKey]; exists {
+	m.lock.Lock()
+	instance, exists := m.limiters[limiterKey]
+	m.lock.Unlock()
+	if exists {
 		instance.LastUsed = time.Now()
-		return m.limiters[limiterKey].Limiter
+		return instance.Limiter, nil
 	}
 
 	rateLimiter := NewLimiter(key, args, limiterType)
-	rateLimiter.prepareLimiter()
+	if err := rateLimiter.prepareLimiter(); err != nil {
+		return nil, err
+	}
+	// Stored state carries the parameters it was written with, the
+	// configuration may have changed since.
+	rateLimiter.reconfigure()
 	rateLimiter.subscribeUpdates()
 	m.lock.Lock()
 	m.limiters[limiterKey] = &limiterInstance{
-		LastUsed: time.Now(),
-		Limiter:  &rateLimiter,
+		LastUsed:    time.Now(),
+		Limiter:     &rateLimiter,
+		ConfigKey:   key,
+		LimiterType: limiterType,
 	}
 	m.lock.Unlock()
 
-	return &rateLimiter
+	return &rateLimiter, nil
 }
 
 func (m *manager) SyncLimiters() {
@@ -64,16 +85,39 @@ func (m *manager) SyncLimiters() {
 			m.lock.Lock()
 			delete(m.limiters, key)
 			m.lock.Unlock()
-			go (*value.Limiter).clear()
+			// Persist the final state before dropping the limiter from memory,
+			// limiters like quotas outlive their in-memory instance.
+			go func(rateLimiter Limiter) {
+				rateLimiter.sync()
+				rateLimiter.clear()
+			}(*value.Limiter)
 		}
 	}
 	m.lastSynced = now
 }
 
+// evictLimiters drops the live limiters built from any of configKeys and
+// closes their update subscriptions.
+func (m *manager) evictLimiters(configKeys []string) {
+	evict := map[string]bool{}
+	for _, configKey := range configKeys {
+		evict[configKey] = true
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, value := range m.limiters {
+		if evict[value.ConfigKey] {
+			delete(m.limiters, key)
+			(*value.Limiter).clear()
+		}
+	}
+}
+
 func (m *manager) StopAll() {
 	m.lock.Lock()
 	for key, value := range m.limiters {
 		delete(m.limiters, key)
+		(*value.Limiter).sync()
 		(*value.Limiter).clear()
 	}
 	m.lock.Unlock()
@@ -0,0 +1,111 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"rate-limiting-service/internal/storage"
+	"sort"
+)
+
+// Override gives args matching a pattern their own configuration instead of
+// the one of the key. The configuration is stored under "<key>@<name>".
+type Override struct {
+	Name     string `json:"name"`
+	ArgIndex int    `json:"argIndex"`
+	Match    string `json:"match"`
+	Priority int    `json:"priority"`
+}
+
+func OverrideConfigKey(key string, name string) string {
+	return key + "@" + name
+}
+
+// matches reports whether args[ArgIndex] matches the glob pattern, e.g.
+// "1234" or "enterprise-*".
+func (o Override) matches(args []string) bool {
+	if o.ArgIndex < 0 || o.ArgIndex >= len(args) {
+		return false
+	}
+	matched, _ := path.Match(o.Match, args[o.ArgIndex])
+	return matched
+}
+
+var KeyOverridesMap = map[string][]Override{}
+
+// GetOverridesForKey returns the overrides of key ordered by priority.
+func GetOverridesForKey(key string) ([]Override, error) {
+	keyCacheLock.RLock()
+	overrides, exists := KeyOverridesMap[key]
+	keyCacheLock.RUnlock()
+	if exists {
+		return overrides, nil
+	}
+	data, err := storage.GetManager().GetOverrides(key)
+	if err != nil {
+		return nil, err
+	}
+	overrides = make([]Override, 0, len(data))
+	for _, value := range data {
+		var override Override
+		if err := json.Unmarshal([]byte(value), &override); err != nil {
+			continue
+		}
+		overrides = append(overrides, override)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Priority != overrides[j].Priority {
+			return overrides[i].Priority < overrides[j].Priority
+		}
+		return overrides[i].Name < overrides[j].Name
+	})
+	keyCacheLock.Lock()
+	KeyOverridesMap[key] = overrides
+	keyCacheLock.Unlock()
+	return overrides, nil
+}
+
+// resolveConfigKey returns the key whose configuration applies to args: the
+// first matching override, or the key itself.
+func resolveConfigKey(key string, args []string) (string, error) {
+	overrides, err := GetOverridesForKey(key)
+	if err != nil {
+		return "", err
+	}
+	for _, override := range overrides {
+		if override.matches(args) {
+			return OverrideConfigKey(key, override.Name), nil
+		}
+	}
+	return key, nil
+}
+
+func SaveOverride(key string, override Override) error {
+	if _, err := path.Match(override.Match, ""); err != nil {
+		return err
+	}
+	data, _ := json.Marshal(override)
+	if err := storage.GetManager().SetOverride(key, override.Name, data); err != nil {
+		return err
+	}
+	ConfigurationChanged(key)
+	return nil
+}
+
+// DeleteOverride removes the override name of key along with its
+// configuration and stored state.
+func DeleteOverride(key string, name string) error {
+	keys := relatedConfigKeys(OverrideConfigKey(key, name))
+	removed, err := storage.GetManager().DeleteOverride(key, name)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errors.New("override not found")
+	}
+	if err := deleteConfigKeys(keys); err != nil {
+		return err
+	}
+	ConfigurationChanged(key)
+	return nil
+}
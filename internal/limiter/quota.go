@@ -0,0 +1,289 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"sync"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	QUOTA_PERIOD_HOUR  = "hour"
+	QUOTA_PERIOD_DAY   = "day"
+	QUOTA_PERIOD_WEEK  = "week"
+	QUOTA_PERIOD_MONTH = "month"
+)
+
+// QUOTA_IDLE_TIMEOUT is how long an unused quota stays in memory. Its state is
+// kept in storage until the end of the period, so it is reloaded when needed.
+const QUOTA_IDLE_TIMEOUT = 5 * time.Minute
+
+// QuotaLimiter allows a fixed number of requests per calendar period (hour,
+// day, week or month) that resets on period boundaries in a given timezone.
+type QuotaLimiter struct {
+	lock          sync.Mutex           `json:"-"`
+	key           string               `json:"-"`
+	args          []string             `json:"-"`
+	sub           storage.Subscription `json:"-"`
+	syncmap       map[string]int64     `json:"-"`
+	localCount    int64                `json:"-"`
+	refundmap     map[string]int64     `json:"-"`
+	localRefunded int64                `json:"-"`
+	loc           *time.Location       `json:"-"`
+	lastUsed      time.Time            `json:"-"`
+	Limit         int                  `json:"limit"`
+	Period        string               `json:"period"`
+	Timezone      string               `json:"timezone"`
+	PeriodStart   time.Time            `json:"periodStart"`
+	Count         int                  `json:"count"`
+	Instances     map[string]int64     `json:"instances"`
+	Refunds       map[string]int64     `json:"refunds"`
+	LastUpdated   time.Time            `json:"lastUpdated"`
+}
+
+type quotaUpdate struct {
+	PeriodStart int64  `json:"periodStart"`
+	Count       int64  `json:"count"`
+	Refunded    int64  `json:"refunded"`
+	LastUpdated int64  `json:"lastUpdated"`
+	InstanceId  string `json:"instanceId"`
+}
+
+func (q *QuotaLimiter) Check(cost int) (bool, map[string]string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := time.Now()
+	periodStart, periodEnd := q.periodBounds(now)
+	q.rollPeriod(periodStart)
+
+	allowed := q.Count+cost <= q.Limit
+	if allowed {
+		q.Count += cost
+		q.localCount += int64(cost)
+		go q.publishUpdate()
+	}
+	q.LastUpdated = now
+	q.lastUsed = now
+
+	remaining := max(q.Limit-q.Count, 0)
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", q.Limit),
+		"X-RateLimit-Remaining": fmt.Sprintf("%d", remaining),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", math.Ceil(periodEnd.Sub(now).Seconds())),
+	}
+	return allowed, headers, nil
+}
+
+func (q *QuotaLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (q *QuotaLimiter) refund(cost int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.Count = max(q.Count-cost, 0)
+	q.localRefunded += int64(cost)
+	q.LastUpdated = time.Now()
+	go q.publishUpdate()
+}
+
+// periodBounds returns the calendar period containing now in the quota's
+// timezone.
+func (q *QuotaLimiter) periodBounds(now time.Time) (time.Time, time.Time) {
+	if q.loc == nil {
+		q.loc = loadLocation(q.Timezone)
+	}
+	t := now.In(q.loc)
+	switch q.Period {
+	case QUOTA_PERIOD_HOUR:
+		start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, q.loc)
+		return start, start.Add(time.Hour)
+	case QUOTA_PERIOD_WEEK:
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, q.loc)
+		return start, start.AddDate(0, 0, 7)
+	case QUOTA_PERIOD_MONTH:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, q.loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.loc)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+func (q *QuotaLimiter) rollPeriod(periodStart time.Time) {
+	if periodStart.Equal(q.PeriodStart) {
+		return
+	}
+	q.PeriodStart = periodStart
+	q.Count = 0
+	q.localCount = 0
+	q.localRefunded = 0
+	q.syncmap = map[string]int64{}
+	q.refundmap = map[string]int64{}
+}
+
+func loadLocation(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (q *QuotaLimiter) Configure(configuration json.RawMessage) error {
+	err := q.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(q.key, QUOTA, q)
+}
+
+func (q *QuotaLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Limit    int    `json:"limit" validate:"required,min=1" message:"limit must be at least 1"`
+		Period   string `json:"period" validate:"required,oneof=hour day week month" message:"period must be hour, day, week or month"`
+		Timezone string `json:"timezone" validate:"omitempty,timezone" message:"timezone must be a valid IANA timezone"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	q.Limit = configurationData.Limit
+	q.Period = configurationData.Period
+	q.Timezone = configurationData.Timezone
+	if q.Timezone == "" {
+		q.Timezone = "UTC"
+	}
+	q.Count = 0
+	return nil
+}
+
+func (q *QuotaLimiter) reconfigure() bool {
+	configured := &QuotaLimiter{}
+	if err := storage.GetManager().GetConfigureData(q.key, configured); err != nil {
+		return false
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.Limit = configured.Limit
+	q.Period = configured.Period
+	q.Timezone = configured.Timezone
+	q.loc = nil
+	return true
+}
+
+func (q *QuotaLimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(QUOTA, q.key, q.args)
+	if err := loadLimiterState(limiterKey, q.key, q); err != nil {
+		return err
+	}
+	q.syncmap, q.localCount = seedInstanceCounts(q.Instances)
+	q.refundmap, q.localRefunded = seedInstanceCounts(q.Refunds)
+	q.lastUsed = time.Now()
+	return nil
+}
+
+func (q *QuotaLimiter) sync() {
+	q.lock.Lock()
+	state := &QuotaLimiter{
+		Limit:       q.Limit,
+		Period:      q.Period,
+		Timezone:    q.Timezone,
+		PeriodStart: q.PeriodStart,
+		Count:       q.Count,
+		Instances:   instanceCounts(q.syncmap, q.localCount),
+		Refunds:     instanceCounts(q.refundmap, q.localRefunded),
+		LastUpdated: q.LastUpdated,
+	}
+	// Keep the state until the period is over so it survives restarts and
+	// instances dropping the limiter from memory.
+	_, periodEnd := q.periodBounds(time.Now())
+	q.lock.Unlock()
+	limiterKey := GetLimiterKey(QUOTA, q.key, q.args)
+	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
+	if previouslastUpdated != "" {
+		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
+		if previouslastUpdatedTime.UnixNano() >= state.LastUpdated.UnixNano() {
+			return
+		}
+	}
+	ttlSeconds := int(math.Ceil(time.Until(periodEnd).Seconds())) + 60
+	storage.GetManager().SetLimiterData(limiterKey, state, ttlSeconds)
+}
+
+func (q *QuotaLimiter) isExpired() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return time.Since(q.lastUsed) > QUOTA_IDLE_TIMEOUT
+}
+
+func (q *QuotaLimiter) publishUpdate() {
+	q.lock.Lock()
+	update := quotaUpdate{
+		PeriodStart: q.PeriodStart.UnixNano(),
+		Count:       q.localCount,
+		Refunded:    q.localRefunded,
+		LastUpdated: q.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	q.lock.Unlock()
+	updatesKey := GetUpdatesKey(QUOTA, q.key, q.args)
+	jsonData, _ := json.Marshal(update)
+	storage.GetManager().PublishUpdates(updatesKey, jsonData)
+}
+
+func (q *QuotaLimiter) subscribeUpdates() {
+	updatesKey := GetUpdatesKey(QUOTA, q.key, q.args)
+	q.sub = storage.GetManager().SubscribeUpdates(updatesKey)
+	ch := q.sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update quotaUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			q.lock.Lock()
+			periodStart, _ := q.periodBounds(time.Now())
+			q.rollPeriod(periodStart)
+			if update.PeriodStart == q.PeriodStart.UnixNano() {
+				// Counts are cumulative per instance and only grow, so only what
+				// is new is applied and updates arriving out of order are ignored.
+				if taken := update.Count - q.syncmap[update.InstanceId]; taken > 0 {
+					q.Count += int(taken)
+					q.syncmap[update.InstanceId] = update.Count
+				}
+				if refunded := update.Refunded - q.refundmap[update.InstanceId]; refunded > 0 {
+					q.Count = max(q.Count-int(refunded), 0)
+					q.refundmap[update.InstanceId] = update.Refunded
+				}
+				if update.LastUpdated > q.LastUpdated.UnixNano() {
+					q.LastUpdated = time.Unix(0, update.LastUpdated)
+				}
+			}
+			q.lock.Unlock()
+		}
+	}()
+}
+
+func (q *QuotaLimiter) clear() {
+	q.sub.Close()
+}
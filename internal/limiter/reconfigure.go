@@ -0,0 +1,139 @@
+package limiter
+
+import (
+	"encoding/json"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"strings"
+)
+
+// CONFIGURE_UPDATES_CHANNEL carries configuration changes between instances,
+// next to the per-limiter "updates:*" channels.
+const CONFIGURE_UPDATES_CHANNEL = "updates:configure"
+
+// ConfigurationUpdate is published on CONFIGURE_UPDATES_CHANNEL whenever the
+// configuration of Key, its sub-limits or its overrides change.
+type ConfigurationUpdate struct {
+	Key        string `json:"key"`
+	Deleted    bool   `json:"deleted"`
+	InstanceId string `json:"instanceId"`
+}
+
+// ConfigurationChanged applies a new configuration of key, its sub-limits or
+// its overrides to the live limiters of this instance and tells the other
+// instances to do the same.
+func ConfigurationChanged(key string) {
+	publishConfigurationUpdate(key, false)
+}
+
+func publishConfigurationUpdate(key string, deleted bool) {
+	GetManager().applyConfigurationUpdate(key, deleted)
+	jsonData, _ := json.Marshal(ConfigurationUpdate{
+		Key:        key,
+		Deleted:    deleted,
+		InstanceId: config.RATE_LIMITING_INSTANCE_ID,
+	})
+	storage.GetManager().PublishUpdates(CONFIGURE_UPDATES_CHANNEL, jsonData)
+}
+
+// SubscribeConfigurationUpdates applies the configuration changes made on
+// other instances until the process exits.
+func (m *manager) SubscribeConfigurationUpdates() {
+	m.subscribeConfigurationUpdates()
+	storage.GetManager().OnReconnect(m.reconnected)
+}
+
+func (m *manager) subscribeConfigurationUpdates() {
+	sub := storage.GetManager().SubscribeUpdates(CONFIGURE_UPDATES_CHANNEL)
+	m.lock.Lock()
+	if m.configureUpdates != nil {
+		m.configureUpdates.Close()
+	}
+	m.configureUpdates = sub
+	m.lock.Unlock()
+	ch := sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update ConfigurationUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			m.applyConfigurationUpdate(update.Key, update.Deleted)
+		}
+	}()
+}
+
+// reconnected catches up with storage once it can be reached again: updates
+// published while it couldn't were missed, so the subscriptions are renewed,
+// every cached configuration is read again and the usage counted locally in
+// the meantime is synced.
+func (m *manager) reconnected() {
+	m.subscribeConfigurationUpdates()
+	keyCacheLock.Lock()
+	KeyLimiterTypeMap = map[string]LimiterType{}
+	KeyOverridesMap = map[string][]Override{}
+	keyCacheLock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for limiterKey, value := range m.limiters {
+		rateLimiter := *value.Limiter
+		rateLimiter.clear()
+		limiterType, err := GetLimiterTypeForKey(value.ConfigKey)
+		if err != nil || limiterType != value.LimiterType || !rateLimiter.reconfigure() {
+			delete(m.limiters, limiterKey)
+			continue
+		}
+		rateLimiter.subscribeUpdates()
+		go rateLimiter.sync()
+	}
+}
+
+// applyConfigurationUpdate drops the cached types and overrides of key and
+// everything configured under it, then reloads the parameters of the live
+// limiters in place so their usage is kept. Limiters whose type changed, or
+// which can't be reconfigured in place, are evicted and rebuilt on their next
+// check.
+func (m *manager) applyConfigurationUpdate(key string, deleted bool) {
+	forgetConfigKeys(key)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for limiterKey, value := range m.limiters {
+		if !isRelatedConfigKey(value.ConfigKey, key) {
+			continue
+		}
+		if !deleted {
+			limiterType, err := GetLimiterTypeForKey(value.ConfigKey)
+			if err == nil && limiterType == value.LimiterType && (*value.Limiter).reconfigure() {
+				continue
+			}
+		}
+		delete(m.limiters, limiterKey)
+		(*value.Limiter).clear()
+	}
+}
+
+// forgetConfigKeys drops the cached types and overrides of key and of the
+// sub-limits and overrides configured under it.
+func forgetConfigKeys(key string) {
+	keyCacheLock.Lock()
+	defer keyCacheLock.Unlock()
+	for configKey := range KeyLimiterTypeMap {
+		if isRelatedConfigKey(configKey, key) {
+			delete(KeyLimiterTypeMap, configKey)
+		}
+	}
+	for configKey := range KeyOverridesMap {
+		if isRelatedConfigKey(configKey, key) {
+			delete(KeyOverridesMap, configKey)
+		}
+	}
+}
+
+// isRelatedConfigKey reports whether configKey is key or one of its
+// sub-limits or overrides, at any depth.
+func isRelatedConfigKey(configKey string, key string) bool {
+	return configKey == key || strings.HasPrefix(configKey, key+"#") || strings.HasPrefix(configKey, key+"@")
+}
@@ -5,27 +5,54 @@ import (
 	"fmt"
 	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/storage"
-	"rate-limiting-service/internal/utils"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/redis/go-redis/v9"
 )
 
+// SlidingWindowLimiter keeps a log of the requests in the window. The log is
+// stored as a sorted set scored by timestamp, to which each instance adds the
+// requests it allowed since its last sync. Peers are only told about the
+// requests logged and refunded since the last update, so what was loaded from
+// storage isn't counted again. Refunds remove the entries this instance
+// logged, which it keeps the members of, rather than a peer's.
 type SlidingWindowLimiter struct {
-	lock        sync.Mutex       `json:"-"`
-	key         string           `json:"-"`
-	args        []string         `json:"-"`
-	sub         *redis.PubSub    `json:"-"`
-	syncmap     map[string]int64 `json:"-"`
-	Capacity    int              `json:"capacity"`
-	WindowSize  time.Duration    `json:"windowSize"`
-	RequestLogs []int64          `json:"requestLog"`
-	LastUpdated time.Time        `json:"lastUpdated"`
-}
-
-func (s *SlidingWindowLimiter) Check() (bool, map[string]string) {
+	lock        sync.Mutex           `json:"-"`
+	key         string               `json:"-"`
+	args        []string             `json:"-"`
+	sub         storage.Subscription `json:"-"`
+	pending     []string             `json:"-"`
+	own         []string             `json:"-"`
+	added       []int64              `json:"-"`
+	removed     []int64              `json:"-"`
+	Capacity    int                  `json:"capacity"`
+	WindowSize  time.Duration        `json:"windowSize"`
+	Consistency string               `json:"consistency"`
+	RequestLogs []int64              `json:"requestLog"`
+	LastUpdated time.Time            `json:"lastUpdated"`
+}
+
+type slidingWindowUpdate struct {
+	RequestLogs []int64 `json:"requestLogs"`
+	Removed     []int64 `json:"removed"`
+	LastUpdated int64   `json:"lastUpdated"`
+	InstanceId  string  `json:"instanceId"`
+}
+
+func (s *SlidingWindowLimiter) Check(cost int) (bool, map[string]string, error) {
+	s.lock.Lock()
+	strict := s.Consistency == CONSISTENCY_STRICT
+	s.lock.Unlock()
+	if strict {
+		allowed, headers, err := s.checkStrict(cost)
+		if err == nil || !decidesLocally(err) {
+			return allowed, headers, err
+		}
+		// Storage can't be reached, fall back to the local log.
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -38,10 +65,17 @@ func (s *SlidingWindowLimiter) Check() (bool, map[string]string) {
 		}
 	}
 	s.RequestLogs = filtered
+	s.trimOwn(cutoff)
 
-	allowed := len(s.RequestLogs) < s.Capacity
+	allowed := len(s.RequestLogs)+cost <= s.Capacity
 	if allowed {
-		s.RequestLogs = append(s.RequestLogs, now.UnixNano())
+		for range cost {
+			member := storage.NewWindowMember(now.UnixNano())
+			s.RequestLogs = append(s.RequestLogs, now.UnixNano())
+			s.pending = append(s.pending, member)
+			s.own = append(s.own, member)
+			s.added = append(s.added, now.UnixNano())
+		}
 		go s.publishUpdate()
 	}
 	s.LastUpdated = now
@@ -56,10 +90,134 @@ func (s *SlidingWindowLimiter) Check() (bool, map[string]string) {
 		"X-RateLimit-Remaining": fmt.Sprintf("%d", remaining),
 		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", reset),
 	}
-	return allowed, headers
+	return allowed, headers, nil
+}
+
+// checkStrict logs the requests in the window kept in storage.
+func (s *SlidingWindowLimiter) checkStrict(cost int) (bool, map[string]string, error) {
+	s.lock.Lock()
+	capacity, windowSize := s.Capacity, s.WindowSize
+	s.lock.Unlock()
+	limiterKey := GetStrictLimiterKey(SLIDING_WINDOW, s.key, s.args)
+	now := time.Now()
+	member := storage.NewWindowMember(now.UnixNano())
+	allowed, count, reset, err := storage.GetManager().AddToWindow(limiterKey, capacity, windowSize, cost, member)
+	if err != nil {
+		return false, nil, err
+	}
+	if allowed {
+		s.lock.Lock()
+		s.trimOwn(now.Add(-windowSize))
+		for i := range cost {
+			s.own = append(s.own, fmt.Sprintf("%s:%d", member, i+1))
+		}
+		s.lock.Unlock()
+	}
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%d", max(capacity-count, 0)),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", reset.Seconds()),
+	}
+	return allowed, headers, nil
+}
+
+// Peek counts the requests in the window as Check would, without logging
+// any.
+func (s *SlidingWindowLimiter) Peek(cost int) (bool, map[string]string, error) {
+	s.lock.Lock()
+	capacity, windowSize := s.Capacity, s.WindowSize
+	strict := s.Consistency == CONSISTENCY_STRICT
+	now := time.Now()
+	count := 0
+	reset := time.Duration(0)
+	for _, t := range s.RequestLogs {
+		if age := now.Sub(time.Unix(0, t)); age < windowSize {
+			if count == 0 {
+				reset = windowSize - age
+			}
+			count++
+		}
+	}
+	s.lock.Unlock()
+	if strict {
+		// Logging no requests only drops the ones that left the window.
+		limiterKey := GetStrictLimiterKey(SLIDING_WINDOW, s.key, s.args)
+		_, storedCount, storedReset, err := storage.GetManager().AddToWindow(limiterKey, capacity, windowSize, 0, "")
+		if err == nil {
+			count, reset = storedCount, storedReset
+		} else if !decidesLocally(err) {
+			return false, nil, err
+		}
+	}
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%d", max(capacity-count, 0)),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", reset.Seconds()),
+	}
+	return count+cost <= capacity, headers, nil
+}
+
+// refund removes the newest cost requests this instance logged. The ones not
+// synced yet are only dropped from what is left to sync.
+func (s *SlidingWindowLimiter) refund(cost int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	refunded := s.own[len(s.own)-min(cost, len(s.own)):]
+	s.own = s.own[:len(s.own)-len(refunded)]
+	synced := []string{}
+	for i := len(refunded) - 1; i >= 0; i-- {
+		member := refunded[i]
+		if len(s.pending) > 0 && s.pending[len(s.pending)-1] == member {
+			s.pending = s.pending[:len(s.pending)-1]
+		} else {
+			synced = append(synced, member)
+		}
+		timestamp := storage.WindowMemberTimestamp(member)
+		if logs := removeTimestamp(s.RequestLogs, timestamp); len(logs) < len(s.RequestLogs) {
+			s.RequestLogs = logs
+			s.removed = append(s.removed, timestamp)
+		}
+	}
+	if len(synced) > 0 {
+		logKey := getWindowLogKey(s.key, s.args)
+		if s.Consistency == CONSISTENCY_STRICT {
+			logKey = GetStrictLimiterKey(SLIDING_WINDOW, s.key, s.args)
+		}
+		storage.GetManager().RemoveFromWindow(logKey, synced)
+	}
+	s.LastUpdated = time.Now()
+	go s.publishUpdate()
+}
+
+// trimOwn forgets the members this instance logged up to cutoff, they have
+// left the window.
+func (s *SlidingWindowLimiter) trimOwn(cutoff time.Time) {
+	i := 0
+	for i < len(s.own) && storage.WindowMemberTimestamp(s.own[i]) <= cutoff.UnixNano() {
+		i++
+	}
+	s.own = s.own[i:]
+}
+
+// removeTimestamp drops the newest entry of timestamp from logs.
+func removeTimestamp(logs []int64, timestamp int64) []int64 {
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i] == timestamp {
+			return append(logs[:i], logs[i+1:]...)
+		}
+	}
+	return logs
 }
 
 func (s *SlidingWindowLimiter) Configure(configuration json.RawMessage) error {
+	err := s.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(s.key, SLIDING_WINDOW, s)
+}
+
+func (s *SlidingWindowLimiter) parseConfiguration(configuration json.RawMessage) error {
 	var configurationData struct {
 		Capacity         int `json:"capacity" validate:"required" message:"capacity is required"`
 		WindowSizeInSecs int `json:"windowSize" validate:"required" message:"windowSize in seconds is required"`
@@ -79,36 +237,62 @@ func (s *SlidingWindowLimiter) Configure(configuration json.RawMessage) error {
 	s.WindowSize = time.Second * time.Duration(configurationData.WindowSizeInSecs)
 	s.RequestLogs = []int64{}
 	s.LastUpdated = time.Now()
-	storage.GetManager().SetConfigureData(s.key, SLIDING_WINDOW, s)
 	return nil
 }
 
-func (s *SlidingWindowLimiter) prepareLimiter() {
-	limiterKey := GetLimiterKey(SLIDING_WINDOW, s.key, s.args)
-	err := storage.GetManager().GetLimiterData(limiterKey, s)
-	if err != nil {
-		if err.Error() == storage.ErrDataNotFound {
-			err = storage.GetManager().GetConfigureData(s.key, s)
-			if err != nil && err.Error() == storage.ErrDataNotFound {
-				panic("rate limiter not configured")
-			}
-		} else {
-			panic(err)
-		}
+func (s *SlidingWindowLimiter) reconfigure() bool {
+	configured := &SlidingWindowLimiter{}
+	if err := storage.GetManager().GetConfigureData(s.key, configured); err != nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Capacity = configured.Capacity
+	s.WindowSize = configured.WindowSize
+	s.Consistency = configured.Consistency
+	return true
+}
+
+func (s *SlidingWindowLimiter) prepareLimiter() error {
+	if err := loadConfiguration(s.key, s); err != nil {
+		return err
+	}
+	logKey := getWindowLogKey(s.key, s.args)
+	err := storage.GetManager().MigrateWindowLog(GetLimiterKey(SLIDING_WINDOW, s.key, s.args), logKey)
+	if err == nil {
+		s.RequestLogs, err = storage.GetManager().GetWindowLog(logKey, time.Now().Add(-s.WindowSize))
 	}
+	if err != nil && err.Error() != storage.ErrUnavailable {
+		return err
+	}
+	// Without storage the window starts empty and is enforced locally.
+	return nil
+}
+
+// getWindowLogKey returns where the log of a sliding window is stored. It
+// replaces the hash at GetLimiterKey, which is only read to migrate it.
+func getWindowLogKey(key string, args []string) string {
+	return "limiter:swlog:" + strings.TrimPrefix(GetLimiterKey(SLIDING_WINDOW, key, args), "limiter:sw:")
 }
 
+// sync adds the requests allowed here since the last sync to the stored log.
 func (s *SlidingWindowLimiter) sync() {
-	limiterKey := GetLimiterKey(SLIDING_WINDOW, s.key, s.args)
-	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
-	if previouslastUpdated != "" {
-		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
-		if previouslastUpdatedTime.UnixNano() >= s.LastUpdated.UnixNano() {
-			return
-		}
+	s.lock.Lock()
+	pending := s.pending
+	s.pending = nil
+	cutoff := time.Now().Add(-s.WindowSize)
+	ttl := s.WindowSize*2 + 2*time.Second
+	s.lock.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	err := storage.GetManager().AddToWindowLog(getWindowLogKey(s.key, s.args), pending, cutoff, ttl)
+	if err != nil {
+		// Try again on the next sync.
+		s.lock.Lock()
+		s.pending = append(pending, s.pending...)
+		s.lock.Unlock()
 	}
-	ttlSeconds := int(s.WindowSize)/int(time.Second)*2 + 2
-	storage.GetManager().SetLimiterData(limiterKey, s, ttlSeconds)
 }
 
 func (s *SlidingWindowLimiter) isExpired() bool {
@@ -116,51 +300,43 @@ func (s *SlidingWindowLimiter) isExpired() bool {
 }
 
 func (s *SlidingWindowLimiter) publishUpdate() {
-	updatesKey := GetUpdatesKey(SLIDING_WINDOW, s.key, s.args)
-	state := map[string]any{
-		"requestLogs": s.RequestLogs,
-		"lastUpdated": s.LastUpdated.UnixNano(),
-		"instanceId":  config.RATE_LIMITING_INSTANCE_ID,
+	s.lock.Lock()
+	update := slidingWindowUpdate{
+		RequestLogs: s.added,
+		Removed:     s.removed,
+		LastUpdated: s.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	s.added, s.removed = nil, nil
+	s.lock.Unlock()
+	if len(update.RequestLogs) == 0 && len(update.Removed) == 0 {
+		return
 	}
-	jsonData, _ := json.Marshal(state)
+	updatesKey := GetUpdatesKey(SLIDING_WINDOW, s.key, s.args)
+	jsonData, _ := json.Marshal(update)
 	storage.GetManager().PublishUpdates(updatesKey, jsonData)
 }
 
 func (s *SlidingWindowLimiter) subscribeUpdates() {
 	updatesKey := GetUpdatesKey(SLIDING_WINDOW, s.key, s.args)
 	s.sub = storage.GetManager().SubscribeUpdates(updatesKey)
-	s.syncmap = map[string]int64{}
 	ch := s.sub.Channel()
 	go func() {
 		for msg := range ch {
-			var state map[string]any
-			if err := json.Unmarshal([]byte(msg.Payload), &state); err != nil {
+			var update slidingWindowUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
 				continue
 			}
-			instanceId := state["instanceId"].(string)
-			if instanceId == config.RATE_LIMITING_INSTANCE_ID {
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
 				continue
 			}
-			reqlogs, err := utils.GetFloat64Slice(state, "requestLogs")
-			if err != nil {
-				panic("request log invalid")
-			}
-			lastUpdatedNano := int64(state["lastUpdated"].(float64))
 			s.lock.Lock()
-			if lastUpdatedNano > s.LastUpdated.UnixNano() {
-				lastUpdated := time.Unix(0, lastUpdatedNano)
-				instanceLastSyncedNano := s.syncmap[instanceId]
-				cutoffTime := time.Unix(0, instanceLastSyncedNano)
-
-				newestReqLogs := []int64{}
-				for _, t := range reqlogs {
-					if time.Unix(0, int64(t)).After(cutoffTime) {
-						newestReqLogs = append(newestReqLogs, int64(t))
-					}
-				}
-				s.RequestLogs = append(s.RequestLogs, newestReqLogs...)
-				s.LastUpdated = lastUpdated
-				s.syncmap[instanceId] = lastUpdatedNano
+			s.RequestLogs = append(s.RequestLogs, update.RequestLogs...)
+			for _, timestamp := range update.Removed {
+				s.RequestLogs = removeTimestamp(s.RequestLogs, timestamp)
+			}
+			if update.LastUpdated > s.LastUpdated.UnixNano() {
+				s.LastUpdated = time.Unix(0, update.LastUpdated)
 			}
 			s.lock.Unlock()
 		}
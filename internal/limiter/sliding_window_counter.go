@@ -0,0 +1,247 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// SlidingWindowCounterLimiter approximates a sliding window by weighting the
+// previous fixed window's count by how much of it still overlaps the sliding
+// window, so only two counters are kept per key.
+type SlidingWindowCounterLimiter struct {
+	lock          sync.Mutex           `json:"-"`
+	key           string               `json:"-"`
+	args          []string             `json:"-"`
+	sub           storage.Subscription `json:"-"`
+	syncmap       map[string]int64     `json:"-"`
+	localCount    int64                `json:"-"`
+	refundmap     map[string]int64     `json:"-"`
+	localRefunded int64                `json:"-"`
+	Capacity      int                  `json:"capacity"`
+	WindowSize    time.Duration        `json:"windowSize"`
+	WindowStart   time.Time            `json:"windowStart"`
+	CurrentCount  int                  `json:"currentCount"`
+	PreviousCount int                  `json:"previousCount"`
+	Instances     map[string]int64     `json:"instances"`
+	Refunds       map[string]int64     `json:"refunds"`
+	LastUpdated   time.Time            `json:"lastUpdated"`
+}
+
+type slidingWindowCounterUpdate struct {
+	WindowStart int64  `json:"windowStart"`
+	Count       int64  `json:"count"`
+	Refunded    int64  `json:"refunded"`
+	LastUpdated int64  `json:"lastUpdated"`
+	InstanceId  string `json:"instanceId"`
+}
+
+func (s *SlidingWindowCounterLimiter) Check(cost int) (bool, map[string]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.rollWindow(now)
+
+	estimate := s.estimate(now)
+	allowed := estimate+float64(cost) <= float64(s.Capacity)
+	if allowed {
+		s.CurrentCount += cost
+		s.localCount += int64(cost)
+		estimate += float64(cost)
+		go s.publishUpdate()
+	}
+	s.LastUpdated = now
+
+	remaining := max(math.Floor(float64(s.Capacity)-estimate), 0)
+	reset := s.WindowStart.Add(s.WindowSize).Sub(now).Seconds()
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%d", s.Capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%.0f", remaining),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", reset),
+	}
+	return allowed, headers, nil
+}
+
+func (s *SlidingWindowCounterLimiter) Peek(cost int) (bool, map[string]string, error) {
+	return false, nil, errPeekNotSupported
+}
+
+func (s *SlidingWindowCounterLimiter) refund(cost int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.CurrentCount = max(s.CurrentCount-cost, 0)
+	s.localRefunded += int64(cost)
+	s.LastUpdated = time.Now()
+	go s.publishUpdate()
+}
+
+// estimate returns the approximate number of requests in the sliding window
+// ending at now.
+func (s *SlidingWindowCounterLimiter) estimate(now time.Time) float64 {
+	elapsed := now.Sub(s.WindowStart).Seconds() / s.WindowSize.Seconds()
+	previousWeight := max(1-elapsed, 0)
+	return float64(s.PreviousCount)*previousWeight + float64(s.CurrentCount)
+}
+
+// rollWindow moves the limiter into the epoch-aligned window containing now.
+func (s *SlidingWindowCounterLimiter) rollWindow(now time.Time) {
+	windowStart := time.Unix(0, now.UnixNano()-now.UnixNano()%int64(s.WindowSize))
+	if windowStart.Equal(s.WindowStart) {
+		return
+	}
+	if windowStart.Equal(s.WindowStart.Add(s.WindowSize)) {
+		s.PreviousCount = s.CurrentCount
+	} else {
+		s.PreviousCount = 0
+	}
+	s.WindowStart = windowStart
+	s.CurrentCount = 0
+	s.localCount = 0
+	s.localRefunded = 0
+	s.syncmap = map[string]int64{}
+	s.refundmap = map[string]int64{}
+}
+
+func (s *SlidingWindowCounterLimiter) Configure(configuration json.RawMessage) error {
+	err := s.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(s.key, SLIDING_WINDOW_COUNTER, s)
+}
+
+func (s *SlidingWindowCounterLimiter) parseConfiguration(configuration json.RawMessage) error {
+	var configurationData struct {
+		Capacity         int `json:"capacity" validate:"required,min=1" message:"capacity must be at least 1"`
+		WindowSizeInSecs int `json:"windowSize" validate:"required,min=1" message:"windowSize in seconds must be at least 1"`
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err := json.Unmarshal(configuration, &configurationData)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(configurationData)
+	if err != nil {
+		return err
+	}
+
+	s.Capacity = configurationData.Capacity
+	s.WindowSize = time.Second * time.Duration(configurationData.WindowSizeInSecs)
+	s.CurrentCount = 0
+	s.PreviousCount = 0
+	s.LastUpdated = time.Now()
+	return nil
+}
+
+func (s *SlidingWindowCounterLimiter) reconfigure() bool {
+	configured := &SlidingWindowCounterLimiter{}
+	if err := storage.GetManager().GetConfigureData(s.key, configured); err != nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Capacity = configured.Capacity
+	s.WindowSize = configured.WindowSize
+	return true
+}
+
+func (s *SlidingWindowCounterLimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(SLIDING_WINDOW_COUNTER, s.key, s.args)
+	if err := loadLimiterState(limiterKey, s.key, s); err != nil {
+		return err
+	}
+	s.syncmap, s.localCount = seedInstanceCounts(s.Instances)
+	s.refundmap, s.localRefunded = seedInstanceCounts(s.Refunds)
+	return nil
+}
+
+func (s *SlidingWindowCounterLimiter) sync() {
+	s.lock.Lock()
+	state := &SlidingWindowCounterLimiter{
+		Capacity:      s.Capacity,
+		WindowSize:    s.WindowSize,
+		WindowStart:   s.WindowStart,
+		CurrentCount:  s.CurrentCount,
+		PreviousCount: s.PreviousCount,
+		Instances:     instanceCounts(s.syncmap, s.localCount),
+		Refunds:       instanceCounts(s.refundmap, s.localRefunded),
+		LastUpdated:   s.LastUpdated,
+	}
+	s.lock.Unlock()
+	limiterKey := GetLimiterKey(SLIDING_WINDOW_COUNTER, s.key, s.args)
+	previouslastUpdated, _ := storage.GetManager().GetLimiterField(limiterKey, "lastUpdated")
+	if previouslastUpdated != "" {
+		previouslastUpdatedTime, _ := time.Parse(time.RFC3339Nano, previouslastUpdated)
+		if previouslastUpdatedTime.UnixNano() >= state.LastUpdated.UnixNano() {
+			return
+		}
+	}
+	ttlSeconds := int(state.WindowSize)/int(time.Second)*2 + 2
+	storage.GetManager().SetLimiterData(limiterKey, state, ttlSeconds)
+}
+
+func (s *SlidingWindowCounterLimiter) isExpired() bool {
+	return time.Since(s.LastUpdated) > s.WindowSize*2
+}
+
+func (s *SlidingWindowCounterLimiter) publishUpdate() {
+	s.lock.Lock()
+	update := slidingWindowCounterUpdate{
+		WindowStart: s.WindowStart.UnixNano(),
+		Count:       s.localCount,
+		Refunded:    s.localRefunded,
+		LastUpdated: s.LastUpdated.UnixNano(),
+		InstanceId:  config.RATE_LIMITING_INSTANCE_ID,
+	}
+	s.lock.Unlock()
+	updatesKey := GetUpdatesKey(SLIDING_WINDOW_COUNTER, s.key, s.args)
+	jsonData, _ := json.Marshal(update)
+	storage.GetManager().PublishUpdates(updatesKey, jsonData)
+}
+
+func (s *SlidingWindowCounterLimiter) subscribeUpdates() {
+	updatesKey := GetUpdatesKey(SLIDING_WINDOW_COUNTER, s.key, s.args)
+	s.sub = storage.GetManager().SubscribeUpdates(updatesKey)
+	ch := s.sub.Channel()
+	go func() {
+		for msg := range ch {
+			var update slidingWindowCounterUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if update.InstanceId == config.RATE_LIMITING_INSTANCE_ID {
+				continue
+			}
+			s.lock.Lock()
+			s.rollWindow(time.Now())
+			if update.WindowStart == s.WindowStart.UnixNano() {
+				// Counts are cumulative per instance and only grow, so only what
+				// is new is applied and updates arriving out of order are ignored.
+				if taken := update.Count - s.syncmap[update.InstanceId]; taken > 0 {
+					s.CurrentCount += int(taken)
+					s.syncmap[update.InstanceId] = update.Count
+				}
+				if refunded := update.Refunded - s.refundmap[update.InstanceId]; refunded > 0 {
+					s.CurrentCount = max(s.CurrentCount-int(refunded), 0)
+					s.refundmap[update.InstanceId] = update.Refunded
+				}
+				if update.LastUpdated > s.LastUpdated.UnixNano() {
+					s.LastUpdated = time.Unix(0, update.LastUpdated)
+				}
+			}
+			s.lock.Unlock()
+		}
+	}()
+}
+
+func (s *SlidingWindowCounterLimiter) clear() {
+	s.sub.Close()
+}
@@ -10,21 +10,29 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/redis/go-redis/v9"
 )
 
 type TokenBucketLimiter struct {
-	lock       sync.Mutex    `json:"-"`
-	key        string        `json:"-"`
-	args       []string      `json:"-"`
-	sub        *redis.PubSub `json:"-"`
-	Capacity   float64       `json:"capacity"`
-	RefillRate float64       `json:"refillRate"`
-	Tokens     float64       `json:"tokens"`
-	LastRefill time.Time     `json:"lastRefill"`
+	lock        sync.Mutex           `json:"-"`
+	key         string               `json:"-"`
+	args        []string             `json:"-"`
+	sub         storage.Subscription `json:"-"`
+	Capacity    float64              `json:"capacity"`
+	RefillRate  float64              `json:"refillRate"`
+	Consistency string               `json:"consistency"`
+	Tokens      float64              `json:"tokens"`
+	LastRefill  time.Time            `json:"lastRefill"`
 }
 
 func (b *TokenBucketLimiter) Configure(configuration json.RawMessage) error {
+	err := b.parseConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	return storage.GetManager().SetConfigureData(b.key, TOKEN_BUCKET, b)
+}
+
+func (b *TokenBucketLimiter) parseConfiguration(configuration json.RawMessage) error {
 	var configurationData struct {
 		Capacity   float64 `json:"capacity" validate:"required" message:"capacity is required"`
 		RefillRate float64 `json:"refillRate" validate:"required" message:"refillRate is required"`
@@ -42,11 +50,36 @@ func (b *TokenBucketLimiter) Configure(configuration json.RawMessage) error {
 
 	b.Capacity = configurationData.Capacity
 	b.RefillRate = configurationData.RefillRate
-	storage.GetManager().SetConfigureData(b.key, TOKEN_BUCKET, b)
 	return nil
 }
 
-func (b *TokenBucketLimiter) Check() (bool, map[string]string) {
+func (b *TokenBucketLimiter) reconfigure() bool {
+	configured := &TokenBucketLimiter{}
+	if err := storage.GetManager().GetConfigureData(b.key, configured); err != nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// Keep the tokens already used: a bigger bucket gives the difference back.
+	b.Tokens = math.Max(0, math.Min(configured.Capacity, b.Tokens+configured.Capacity-b.Capacity))
+	b.Capacity = configured.Capacity
+	b.RefillRate = configured.RefillRate
+	b.Consistency = configured.Consistency
+	return true
+}
+
+func (b *TokenBucketLimiter) Check(cost int) (bool, map[string]string, error) {
+	b.lock.Lock()
+	strict := b.Consistency == CONSISTENCY_STRICT
+	b.lock.Unlock()
+	if strict {
+		allowed, headers, err := b.checkStrict(cost)
+		if err == nil || !decidesLocally(err) {
+			return allowed, headers, err
+		}
+		// Storage can't be reached, fall back to the local bucket.
+	}
+
 	b.lock.Lock()
 	defer b.lock.Unlock()
 	now := time.Now()
@@ -54,35 +87,95 @@ func (b *TokenBucketLimiter) Check() (bool, map[string]string) {
 	b.Tokens = math.Min(b.Capacity, b.Tokens+elapsed*b.RefillRate)
 	b.LastRefill = now
 	resetSeconds := math.Ceil((b.Capacity - b.Tokens) / b.RefillRate)
-	if b.Tokens >= 1 {
-		b.Tokens -= 1
+	if b.Tokens >= float64(cost) {
+		b.Tokens -= float64(cost)
 		go b.publishUpdate()
 		return true, map[string]string{
 			"X-RateLimit-Limit":     fmt.Sprintf("%.0f", b.Capacity),
-			"X-RateLimit-Remaining": fmt.Sprintf("%.0f", b.Tokens),
+			"X-RateLimit-Remaining": fmt.Sprintf("%.0f", math.Floor(b.Tokens)),
 			"X-RateLimit-Reset":     fmt.Sprintf("%.0f", resetSeconds),
-		}
+		}, nil
 	}
-	return false, map[string]string{
+	// Not enough tokens for the whole cost: nothing is consumed, and the caller
+	// learns how much is left and when the full cost will be available.
+	headers := map[string]string{
 		"X-RateLimit-Limit":     fmt.Sprintf("%.0f", b.Capacity),
-		"X-RateLimit-Remaining": fmt.Sprintf("%.0f", b.Tokens),
+		"X-RateLimit-Remaining": fmt.Sprintf("%.0f", math.Floor(b.Tokens)),
 		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", resetSeconds),
 	}
+	if float64(cost) <= b.Capacity {
+		headers["Retry-After"] = fmt.Sprintf("%.0f", math.Ceil((float64(cost)-b.Tokens)/b.RefillRate))
+	}
+	return false, headers, nil
 }
 
-func (b *TokenBucketLimiter) prepareLimiter() {
-	limiterKey := GetLimiterKey(TOKEN_BUCKET, b.key, b.args)
-	err := storage.GetManager().GetLimiterData(limiterKey, b)
+// checkStrict takes the tokens from the bucket kept in storage.
+func (b *TokenBucketLimiter) checkStrict(cost int) (bool, map[string]string, error) {
+	b.lock.Lock()
+	capacity, refillRate := b.Capacity, b.RefillRate
+	b.lock.Unlock()
+	limiterKey := GetStrictLimiterKey(TOKEN_BUCKET, b.key, b.args)
+	allowed, tokens, err := storage.GetManager().TakeTokens(limiterKey, capacity, refillRate, cost)
 	if err != nil {
-		if err.Error() == storage.ErrDataNotFound {
-			err = storage.GetManager().GetConfigureData(b.key, b)
-			if err != nil && err.Error() == storage.ErrDataNotFound {
-				panic("rate limiter not configured")
-			}
-		} else {
-			panic(err)
+		return false, nil, err
+	}
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%.0f", capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%.0f", math.Floor(tokens)),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", math.Ceil((capacity-tokens)/refillRate)),
+	}
+	if !allowed && float64(cost) <= capacity {
+		headers["Retry-After"] = fmt.Sprintf("%.0f", math.Ceil((float64(cost)-tokens)/refillRate))
+	}
+	return allowed, headers, nil
+}
+
+// Peek refills the bucket as Check would, without taking tokens or syncing
+// anything.
+func (b *TokenBucketLimiter) Peek(cost int) (bool, map[string]string, error) {
+	b.lock.Lock()
+	capacity, refillRate := b.Capacity, b.RefillRate
+	strict := b.Consistency == CONSISTENCY_STRICT
+	tokens := math.Min(capacity, b.Tokens+time.Since(b.LastRefill).Seconds()*refillRate)
+	b.lock.Unlock()
+	if strict {
+		// Taking no tokens only refills the bucket kept in storage.
+		limiterKey := GetStrictLimiterKey(TOKEN_BUCKET, b.key, b.args)
+		_, storedTokens, err := storage.GetManager().TakeTokens(limiterKey, capacity, refillRate, 0)
+		if err == nil {
+			tokens = storedTokens
+		} else if !decidesLocally(err) {
+			return false, nil, err
+		}
+	}
+	allowed := tokens >= float64(cost)
+	headers := map[string]string{
+		"X-RateLimit-Limit":     fmt.Sprintf("%.0f", capacity),
+		"X-RateLimit-Remaining": fmt.Sprintf("%.0f", math.Floor(tokens)),
+		"X-RateLimit-Reset":     fmt.Sprintf("%.0f", math.Ceil((capacity-tokens)/refillRate)),
+	}
+	if !allowed && float64(cost) <= capacity {
+		headers["Retry-After"] = fmt.Sprintf("%.0f", math.Ceil((float64(cost)-tokens)/refillRate))
+	}
+	return allowed, headers, nil
+}
+
+func (b *TokenBucketLimiter) refund(cost int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.Consistency == CONSISTENCY_STRICT {
+		limiterKey := GetStrictLimiterKey(TOKEN_BUCKET, b.key, b.args)
+		if _, _, err := storage.GetManager().TakeTokens(limiterKey, b.Capacity, b.RefillRate, -cost); err == nil {
+			return
 		}
 	}
+	b.Tokens = math.Min(b.Capacity, b.Tokens+float64(cost))
+	go b.publishUpdate()
+}
+
+func (b *TokenBucketLimiter) prepareLimiter() error {
+	limiterKey := GetLimiterKey(TOKEN_BUCKET, b.key, b.args)
+	return loadLimiterState(limiterKey, b.key, b)
 }
 
 func (b *TokenBucketLimiter) sync() {
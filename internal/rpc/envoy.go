@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"context"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/limiter"
+	"rate-limiting-service/internal/services"
+	"rate-limiting-service/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// EnvoyServer answers the Rate Limit Service protocol of Envoy's global rate
+// limit filter, so Envoy can use this service in place of lyft/ratelimit.
+//
+// Every descriptor is limited by the key made of the domain and the entry
+// keys, joined by dots, with the entry values as args. The descriptor
+// [{remote_address: 10.0.0.1}, {path: /users}] of the domain edge is checked
+// against the key edge.remote_address.path with the args [10.0.0.1, /users].
+// Descriptors without a configured key aren't limited.
+//
+// Envoy never releases, so concurrency limiters only free their slots once
+// the lease TTL passes.
+type EnvoyServer struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+}
+
+// envoyHeaders are the limiter headers passed on to Envoy.
+var envoyHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+
+func NewEnvoyServer() *EnvoyServer {
+	return &EnvoyServer{}
+}
+
+func (s *EnvoyServer) ShouldRateLimit(ctx context.Context, request *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	response := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+		Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, 0, len(request.Descriptors)),
+	}
+	if config.DEGRADED_MODE != services.DEGRADED_MODE_LOCAL && !storage.GetManager().Available() {
+		if config.DEGRADED_MODE == services.DEGRADED_MODE_FAIL_OPEN {
+			for range request.Descriptors {
+				response.Statuses = append(response.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK})
+			}
+			return response, nil
+		}
+		return nil, status.Error(codes.Unavailable, storage.ErrUnavailable)
+	}
+
+	var responseHeaders map[string]string
+	for _, descriptor := range request.Descriptors {
+		cost := max(int(request.HitsAddend), 1)
+		if descriptor.HitsAddend != nil {
+			cost = int(descriptor.HitsAddend.Value)
+		}
+		allowed, headers, err := s.checkDescriptor(request.Domain, descriptor, cost)
+		if err != nil {
+			return nil, statusError("should rate limit", err)
+		}
+		if !allowed {
+			response.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		if headers != nil {
+			responseHeaders = limiter.MostRestrictiveHeaders(responseHeaders, headers)
+		}
+		response.Statuses = append(response.Statuses, descriptorStatus(allowed, headers))
+	}
+
+	for _, header := range envoyHeaders {
+		if value, exists := responseHeaders[header]; exists {
+			response.ResponseHeadersToAdd = append(response.ResponseHeadersToAdd, &corev3.HeaderValue{Key: header, Value: value})
+		}
+	}
+	return response, nil
+}
+
+// checkDescriptor takes cost from the limiter of descriptor, or only reads it
+// for a zero cost. Descriptors without a configuration are allowed without
+// headers.
+func (s *EnvoyServer) checkDescriptor(domain string, descriptor *ratelimitv3.RateLimitDescriptor, cost int) (bool, map[string]string, error) {
+	key, args := DescriptorKey(domain, descriptor)
+	rateLimiter, err := limiter.GetManager().AccessLimiter(key, args)
+	if err != nil {
+		if err.Error() == "key not configured" || err.Error() == "rate limiter not configured" {
+			return true, nil, nil
+		}
+		if err.Error() == storage.ErrUnavailable && config.DEGRADED_MODE == services.DEGRADED_MODE_FAIL_OPEN {
+			return true, nil, nil
+		}
+		return false, nil, err
+	}
+	check := (*rateLimiter).Check
+	if cost == 0 {
+		// Envoy sends a zero addend to read the limit without taking from it.
+		check = (*rateLimiter).Peek
+	}
+	allowed, headers, err := check(cost)
+	if err != nil {
+		if err.Error() == "rate limiter does not support peek" {
+			// Nothing can be read from the limiter, so nothing is reported.
+			return true, nil, nil
+		}
+		if err.Error() == storage.ErrUnavailable && config.DEGRADED_MODE == services.DEGRADED_MODE_FAIL_OPEN {
+			return true, nil, nil
+		}
+		return false, nil, err
+	}
+	return allowed, headers, nil
+}
+
+// DescriptorKey returns the key and args a descriptor of domain is limited by.
+func DescriptorKey(domain string, descriptor *ratelimitv3.RateLimitDescriptor) (string, []string) {
+	keys := []string{domain}
+	args := make([]string, 0, len(descriptor.Entries))
+	for _, entry := range descriptor.Entries {
+		keys = append(keys, entry.Key)
+		args = append(args, entry.Value)
+	}
+	return strings.Join(keys, "."), args
+}
+
+func descriptorStatus(allowed bool, headers map[string]string) *rlsv3.RateLimitResponse_DescriptorStatus {
+	descriptorStatus := &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+	if !allowed {
+		descriptorStatus.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+	}
+	if limit, err := strconv.ParseUint(headers["X-RateLimit-Limit"], 10, 32); err == nil {
+		// The limiters don't all count per unit of time, so the unit is left
+		// unknown.
+		descriptorStatus.CurrentLimit = &rlsv3.RateLimitResponse_RateLimit{
+			RequestsPerUnit: uint32(limit),
+			Unit:            rlsv3.RateLimitResponse_RateLimit_UNKNOWN,
+		}
+	}
+	if remaining, err := strconv.ParseFloat(headers["X-RateLimit-Remaining"], 64); err == nil {
+		descriptorStatus.LimitRemaining = uint32(max(remaining, 0))
+	}
+	if reset, err := strconv.ParseFloat(headers["X-RateLimit-Reset"], 64); err == nil {
+		descriptorStatus.DurationUntilReset = durationpb.New(time.Duration(reset * float64(time.Second)))
+	}
+	return descriptorStatus
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"rate-limiting-service/internal/limiter"
+	"rate-limiting-service/internal/logger"
+	"rate-limiting-service/internal/services"
+	"rate-limiting-service/internal/storage"
+	"rate-limiting-service/pkg/ratelimiterpb"
+	"time"
+
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server answers the gRPC API with the same services as the HTTP one.
+type Server struct {
+	ratelimiterpb.UnimplementedRateLimiterServer
+	validate *validator.Validate
+}
+
+// Serve starts the gRPC API, along with Envoy's Rate Limit Service, on port
+// in the background.
+func Serve(port string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc.NewServer()
+	ratelimiterpb.RegisterRateLimiterServer(grpcServer, NewServer())
+	rlsv3.RegisterRateLimitServiceServer(grpcServer, NewEnvoyServer())
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			fmt.Println("gRPC stopped:", err)
+		}
+	}()
+	return grpcServer, nil
+}
+
+func NewServer() *Server {
+	return &Server{validate: validator.New()}
+}
+
+func (s *Server) Check(ctx context.Context, request *ratelimiterpb.CheckRequest) (*ratelimiterpb.CheckResponse, error) {
+	start := time.Now()
+	checkDTO := checkDTO(request)
+	if err := s.validate.Struct(checkDTO); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	allowed, headers, err := services.Check(checkDTO)
+	if err != nil {
+		return nil, statusError("check", err)
+	}
+	latency := time.Since(start)
+	go services.UpdateMetrics(allowed, latency)
+	logger.LogRequestAsync(allowed, latency)
+
+	response := &ratelimiterpb.CheckResponse{Allowed: allowed, Headers: headers}
+	if checkResponse := services.NewCheckResponse(allowed, headers); checkResponse != nil {
+		response.DelayMs = checkResponse.DelayMs
+		response.LeaseId = checkResponse.LeaseId
+	}
+	return response, nil
+}
+
+func (s *Server) CheckBatch(ctx context.Context, request *ratelimiterpb.CheckBatchRequest) (*ratelimiterpb.CheckBatchResponse, error) {
+	checkBatchDTO := &services.CheckBatchDTO{
+		Items: make([]services.CheckDTO, 0, len(request.Items)),
+		Mode:  request.Mode,
+	}
+	for _, item := range request.Items {
+		checkBatchDTO.Items = append(checkBatchDTO.Items, *checkDTO(item))
+	}
+	if err := s.validate.Struct(checkBatchDTO); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	checkBatchResponse, err := services.CheckBatch(checkBatchDTO)
+	if err != nil {
+		return nil, statusError("check batch", err)
+	}
+	response := &ratelimiterpb.CheckBatchResponse{
+		Allowed: checkBatchResponse.Allowed,
+		Results: make([]*ratelimiterpb.CheckBatchResult, 0, len(checkBatchResponse.Results)),
+	}
+	for _, result := range checkBatchResponse.Results {
+		response.Results = append(response.Results, &ratelimiterpb.CheckBatchResult{
+			Allowed: result.Allowed,
+			Headers: result.Headers,
+			Error:   result.Error,
+		})
+	}
+	return response, nil
+}
+
+func (s *Server) Release(ctx context.Context, request *ratelimiterpb.ReleaseRequest) (*ratelimiterpb.ReleaseResponse, error) {
+	releaseDTO := &services.ReleaseDTO{Key: request.Key, Args: request.Args, LeaseId: request.LeaseId}
+	if err := s.validate.Struct(releaseDTO); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := services.Release(releaseDTO); err != nil {
+		return nil, statusError("release", err)
+	}
+	return &ratelimiterpb.ReleaseResponse{}, nil
+}
+
+func (s *Server) Configure(ctx context.Context, request *ratelimiterpb.ConfigureRequest) (*ratelimiterpb.ConfigureResponse, error) {
+	configureDTO := &services.ConfigureDTO{
+		Key:           request.Key,
+		LimiterType:   limiter.LimiterType(request.LimiterType),
+		Configuration: json.RawMessage(request.Configuration),
+		Consistency:   request.Consistency,
+		Author:        request.Author,
+	}
+	if err := s.validate.Struct(configureDTO); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !json.Valid(configureDTO.Configuration) {
+		return nil, status.Error(codes.InvalidArgument, "configuration must be a JSON object")
+	}
+	if err := services.Configure(configureDTO); err != nil {
+		return nil, statusError("configure", err)
+	}
+	return &ratelimiterpb.ConfigureResponse{}, nil
+}
+
+func (s *Server) GetMetrics(ctx context.Context, request *ratelimiterpb.GetMetricsRequest) (*ratelimiterpb.Metrics, error) {
+	metrics := services.GetMetrics()
+	return &ratelimiterpb.Metrics{
+		TotalRequests: metrics.TotalRequests,
+		Allowed:       metrics.Allowed,
+		Blocked:       metrics.Blocked,
+		AvgLatencyMs:  metrics.AvgLatencyMs,
+	}, nil
+}
+
+func (s *Server) WatchLimits(request *ratelimiterpb.WatchLimitsRequest, stream grpc.ServerStreamingServer[ratelimiterpb.LimitUpdate]) error {
+	err := services.WatchLimits(stream.Context(), request.KeyPrefix, func(update services.LimitUpdate) error {
+		limitUpdate := &ratelimiterpb.LimitUpdate{Key: update.Key, Deleted: update.Deleted}
+		if update.Configuration != nil {
+			limitUpdate.LimiterType = int32(update.Configuration.LimiterType)
+			limitUpdate.Configuration = string(update.Configuration.Configuration)
+			limitUpdate.Consistency = update.Configuration.Consistency
+		}
+		return stream.Send(limitUpdate)
+	})
+	if err != nil {
+		return statusError("watch limits", err)
+	}
+	return nil
+}
+
+func checkDTO(request *ratelimiterpb.CheckRequest) *services.CheckDTO {
+	return &services.CheckDTO{Key: request.Key, Args: request.Args, Cost: int(request.Cost)}
+}
+
+// statusError maps the errors of the services to gRPC codes the way the HTTP
+// handlers map them to status codes.
+func statusError(method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	switch err.Error() {
+	case "rate limiter not found", "lease not found", "key not configured":
+		return status.Error(codes.NotFound, err.Error())
+	case "unknown limiter type", "strict consistency is not supported by this limiter type",
+		"rate limiter does not support release":
+		return status.Error(codes.InvalidArgument, err.Error())
+	case storage.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	fmt.Printf("gRPC %s error: %v\n", method, err)
+	return status.Error(codes.Internal, "Internal server error")
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"rate-limiting-service/internal/limiter"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// AuthMappings picks the key and args /auth checks a forwarded request with,
+// e.g.
+//
+//	# auth.yml
+//	- host: api.example.com
+//	  path: /v1/**
+//	  key: api
+//	  args: [header:X-Api-Key, method]
+//	- path: /login
+//	  key: login
+//	  args: [ip]
+//
+// The first mapping matching the host and path applies. Host and path are
+// path.Match patterns, empty matching anything, and a path ending in /**
+// also matches everything below it. Args are read from:
+//
+//	ip          the client address
+//	method      the request method
+//	host        the requested host
+//	path        the request path
+//	uri         the request path and query
+//	header:NAME a request header
+//	query:NAME  a query parameter
+//
+// Mappings without args use [path, method, ip], like the SDK. JSON files are
+// read the same way.
+type AuthMappings []AuthMapping
+
+type AuthMapping struct {
+	Host string   `json:"host"`
+	Path string   `json:"path"`
+	Key  string   `json:"key" validate:"required" message:"key is required"`
+	Args []string `json:"args"`
+	Cost int      `json:"cost" validate:"omitempty,min=1" message:"cost must be at least 1"`
+}
+
+// AuthRequest is the request a reverse proxy asks /auth about, read from the
+// headers NGINX auth_request and Traefik ForwardAuth forward.
+type AuthRequest struct {
+	Host   string
+	URI    string
+	Method string
+	IP     string
+	Header func(name string) string
+}
+
+var defaultAuthArgs = []string{"path", "method", "ip"}
+
+func ReadAuthMappings(path string) (AuthMappings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document []any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	mappings := AuthMappings{}
+	if err := json.Unmarshal(jsonData, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+func (mappings AuthMappings) Validate() error {
+	validate := validator.New()
+	var errs []error
+	for i, mapping := range mappings {
+		if err := validate.Struct(mapping); err != nil {
+			errs = append(errs, fmt.Errorf("mapping %d: %w", i, err))
+		}
+		for _, pattern := range []string{mapping.Host, strings.TrimSuffix(mapping.Path, "/**")} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("mapping %d: invalid pattern %q", i, pattern))
+			}
+		}
+		for _, arg := range mapping.Args {
+			if !validAuthArg(arg) {
+				errs = append(errs, fmt.Errorf("mapping %d: unknown arg %q", i, arg))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckAuth is Check for /auth. Reverse proxies make no call once the request
+// has finished, so the lease of a concurrency limiter would never be released
+// and is refused instead of held until its TTL.
+func CheckAuth(checkDTO *CheckDTO) (bool, map[string]string, error) {
+	rateLimiter, err := limiter.GetManager().AccessLimiter(checkDTO.Key, checkDTO.Args)
+	if err == nil {
+		if _, ok := (*rateLimiter).(*limiter.ConcurrencyLimiter); ok {
+			return false, nil, errors.New("concurrency limiters can't be used with /auth")
+		}
+	}
+	return Check(checkDTO)
+}
+
+// Resolve returns the check of the first mapping matching request, or nil if
+// none does.
+func (mappings AuthMappings) Resolve(request *AuthRequest) *CheckDTO {
+	uri, err := url.ParseRequestURI(request.URI)
+	if err != nil {
+		uri = &url.URL{Path: request.URI}
+	}
+	for _, mapping := range mappings {
+		if !matchesHost(mapping.Host, request.Host) || !matchesPath(mapping.Path, uri.Path) {
+			continue
+		}
+		sources := mapping.Args
+		if len(sources) == 0 {
+			sources = defaultAuthArgs
+		}
+		args := make([]string, 0, len(sources))
+		for _, source := range sources {
+			args = append(args, authArg(source, request, uri))
+		}
+		return &CheckDTO{Key: mapping.Key, Args: args, Cost: mapping.Cost}
+	}
+	return nil
+}
+
+func matchesHost(pattern string, host string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, host)
+	return matched
+}
+
+func matchesPath(pattern string, requestPath string) bool {
+	if pattern == "" {
+		return true
+	}
+	if prefix, found := strings.CutSuffix(pattern, "/**"); found {
+		if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+	matched, _ := path.Match(pattern, requestPath)
+	return matched
+}
+
+func validAuthArg(source string) bool {
+	switch source {
+	case "ip", "method", "host", "path", "uri":
+		return true
+	}
+	name, found := strings.CutPrefix(source, "header:")
+	if !found {
+		name, found = strings.CutPrefix(source, "query:")
+	}
+	return found && name != ""
+}
+
+func authArg(source string, request *AuthRequest, uri *url.URL) string {
+	switch source {
+	case "ip":
+		return request.IP
+	case "method":
+		return request.Method
+	case "host":
+		return request.Host
+	case "path":
+		return uri.Path
+	case "uri":
+		return uri.RequestURI()
+	}
+	if name, found := strings.CutPrefix(source, "header:"); found {
+		return request.Header(name)
+	}
+	if name, found := strings.CutPrefix(source, "query:"); found {
+		return uri.Query().Get(name)
+	}
+	return ""
+}
+
+// NewAuthRequest reads the forwarded request from headers, falling back to
+// the values of the /auth request itself when the proxy didn't set them.
+func NewAuthRequest(header func(name string) string, host string, uri string, method string, ip string) *AuthRequest {
+	request := &AuthRequest{
+		Host:   firstHeader(header, host, "X-Forwarded-Host"),
+		URI:    firstHeader(header, uri, "X-Original-URI", "X-Forwarded-Uri"),
+		Method: firstHeader(header, method, "X-Original-Method", "X-Forwarded-Method"),
+		IP:     firstHeader(header, ip, "X-Real-IP"),
+		Header: header,
+	}
+	// Without X-Real-IP the client is the address the proxy appended last to
+	// X-Forwarded-For. The ones before it were sent by the client, which can
+	// set them to anything.
+	if forwardedFor := header("X-Forwarded-For"); forwardedFor != "" && header("X-Real-IP") == "" {
+		addresses := strings.Split(forwardedFor, ",")
+		request.IP = strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	return request
+}
+
+func firstHeader(header func(name string) string, fallback string, names ...string) string {
+	for _, name := range names {
+		if value := header(name); value != "" {
+			return value
+		}
+	}
+	return fallback
+}
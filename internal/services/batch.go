@@ -0,0 +1,82 @@
+package services
+
+import "rate-limiting-service/internal/limiter"
+
+// CHECK_BATCH_MODE picks how the items of a batch are evaluated.
+const (
+	// CHECK_BATCH_INDEPENDENT checks every item on its own.
+	CHECK_BATCH_INDEPENDENT = "independent"
+	// CHECK_BATCH_ALL_OR_NOTHING allows the batch only if every item is
+	// allowed. Once an item is denied, or fails, the units taken by the items
+	// before it are given back and the rest aren't checked.
+	CHECK_BATCH_ALL_OR_NOTHING = "all-or-nothing"
+)
+
+type CheckBatchDTO struct {
+	Items []CheckDTO `json:"items" validate:"required,min=1,dive" message:"items are required"`
+	Mode  string     `json:"mode" validate:"omitempty,oneof=independent all-or-nothing" message:"mode must be independent or all-or-nothing"`
+}
+
+type CheckBatchResponse struct {
+	// Allowed is set when every item is allowed.
+	Allowed bool               `json:"allowed"`
+	Results []CheckBatchResult `json:"results"`
+}
+
+type CheckBatchResult struct {
+	Allowed bool              `json:"allowed"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Error tells why the item couldn't be checked, e.g. "rate limiter not
+	// found".
+	Error string `json:"error,omitempty"`
+}
+
+// CheckBatch checks the items of checkBatchDTO in order. In all-or-nothing
+// mode the item that failed is returned as the error.
+func CheckBatch(checkBatchDTO *CheckBatchDTO) (*CheckBatchResponse, error) {
+	response := &CheckBatchResponse{
+		Allowed: true,
+		Results: make([]CheckBatchResult, len(checkBatchDTO.Items)),
+	}
+	if checkBatchDTO.Mode != CHECK_BATCH_ALL_OR_NOTHING {
+		for i := range checkBatchDTO.Items {
+			allowed, headers, err := Check(&checkBatchDTO.Items[i])
+			response.Results[i] = CheckBatchResult{Allowed: allowed, Headers: headers}
+			if err != nil {
+				response.Results[i].Error = err.Error()
+			}
+			response.Allowed = response.Allowed && allowed
+		}
+		return response, nil
+	}
+
+	taken := make([]*limiter.Limiter, len(checkBatchDTO.Items))
+	for i := range checkBatchDTO.Items {
+		allowed, headers, rateLimiter, err := check(&checkBatchDTO.Items[i])
+		response.Results[i] = CheckBatchResult{Allowed: allowed, Headers: headers}
+		taken[i] = rateLimiter
+		if err == nil && allowed {
+			continue
+		}
+		refundBatch(checkBatchDTO.Items[:i], response.Results[:i], taken[:i])
+		if err != nil {
+			return nil, err
+		}
+		response.Allowed = false
+		return response, nil
+	}
+	return response, nil
+}
+
+// refundBatch gives back the units taken by the allowed items of a batch that
+// was denied. Leases that fail to be released expire with their TTL.
+func refundBatch(items []CheckDTO, results []CheckBatchResult, taken []*limiter.Limiter) {
+	for i := len(items) - 1; i >= 0; i-- {
+		results[i].Allowed = false
+		if taken[i] == nil {
+			continue
+		}
+		limiter.Refund(taken[i], items[i].cost(), results[i].Headers)
+		delete(results[i].Headers, limiter.LEASE_HEADER)
+	}
+}
@@ -2,19 +2,143 @@ package services
 
 import (
 	"errors"
+	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/limiter"
+	"rate-limiting-service/internal/storage"
+	"strconv"
 )
 
 type CheckDTO struct {
-	Key  string   `query:"key" validate:"required" message:"Valid key is required"`
-	Args []string `query:"args"`
+	Key  string   `query:"key" json:"key" validate:"required" message:"Valid key is required"`
+	Args []string `query:"args" json:"args"`
+	Cost int      `query:"cost" json:"cost" validate:"omitempty,min=1" message:"cost must be at least 1"`
 }
 
+// CheckResponse is returned as the /check body when the limiter assigned a
+// delay the caller should wait before proceeding, or a lease that has to be
+// released once the request has finished.
+type CheckResponse struct {
+	Allowed bool   `json:"allowed"`
+	DelayMs int64  `json:"delayMs,omitempty"`
+	LeaseId string `json:"leaseId,omitempty"`
+}
+
+// NewCheckResponse builds the /check body from the limiter headers, or returns
+// nil when there is nothing beyond the headers to report.
+func NewCheckResponse(allowed bool, headers map[string]string) *CheckResponse {
+	delay, hasDelay := headers[limiter.DELAY_HEADER]
+	leaseId, hasLease := headers[limiter.LEASE_HEADER]
+	if !hasDelay && !hasLease {
+		return nil
+	}
+	delayMs, _ := strconv.ParseInt(delay, 10, 64)
+	return &CheckResponse{
+		Allowed: allowed,
+		DelayMs: delayMs,
+		LeaseId: leaseId,
+	}
+}
+
+// DEGRADED_MODE picks how checks are answered while storage can't be reached.
+const (
+	// DEGRADED_MODE_LOCAL keeps enforcing limits on each instance on its own,
+	// with the configurations last read.
+	DEGRADED_MODE_LOCAL       = "local"
+	DEGRADED_MODE_FAIL_OPEN   = "fail-open"
+	DEGRADED_MODE_FAIL_CLOSED = "fail-closed"
+)
+
 func Check(checkDTO *CheckDTO) (bool, map[string]string, error) {
-	rateLimiter := limiter.GetManager().AccessLimiter(checkDTO.Key, checkDTO.Args)
-	if rateLimiter == nil {
-		return false, nil, errors.New("rate limiter not found")
+	allowed, headers, _, err := check(checkDTO)
+	return allowed, headers, err
+}
+
+// check is Check, also returning the limiter the units were taken from, or
+// nil when none were.
+func check(checkDTO *CheckDTO) (bool, map[string]string, *limiter.Limiter, error) {
+	if config.DEGRADED_MODE != DEGRADED_MODE_LOCAL && !storage.GetManager().Available() {
+		allowed, headers, err := degradedCheck(errors.New(storage.ErrUnavailable))
+		return allowed, headers, nil, err
+	}
+	rateLimiter, err := limiter.GetManager().AccessLimiter(checkDTO.Key, checkDTO.Args)
+	if err != nil {
+		allowed, headers, err := degradedCheck(accessError(err))
+		return allowed, headers, nil, err
+	}
+	allowed, headers, err := (*rateLimiter).Check(checkDTO.cost())
+	if err != nil {
+		allowed, headers, err := degradedCheck(err)
+		return allowed, headers, nil, err
+	}
+	if !allowed {
+		return false, headers, nil, nil
+	}
+	return true, headers, rateLimiter, nil
+}
+
+func (checkDTO *CheckDTO) cost() int {
+	if checkDTO.Cost == 0 {
+		return 1
+	}
+	return checkDTO.Cost
+}
+
+// StatusResponse is the /status body, read from the limiter headers.
+type StatusResponse struct {
+	Allowed      bool  `json:"allowed"`
+	Limit        int64 `json:"limit"`
+	Remaining    int64 `json:"remaining"`
+	ResetSeconds int64 `json:"resetSeconds"`
+	// RetryAfterSeconds is set when the check would be denied and the limiter
+	// knows when it will be allowed.
+	RetryAfterSeconds int64 `json:"retryAfterSeconds,omitempty"`
+}
+
+func NewStatusResponse(allowed bool, headers map[string]string) *StatusResponse {
+	header := func(name string) int64 {
+		value, _ := strconv.ParseInt(headers[name], 10, 64)
+		return value
+	}
+	return &StatusResponse{
+		Allowed:           allowed,
+		Limit:             header("X-RateLimit-Limit"),
+		Remaining:         header("X-RateLimit-Remaining"),
+		ResetSeconds:      header("X-RateLimit-Reset"),
+		RetryAfterSeconds: header("Retry-After"),
+	}
+}
+
+// Peek reports what Check would answer for checkDTO without taking anything
+// from the limiter, the same way while storage can't be reached.
+func Peek(checkDTO *CheckDTO) (bool, map[string]string, error) {
+	if config.DEGRADED_MODE != DEGRADED_MODE_LOCAL && !storage.GetManager().Available() {
+		return degradedCheck(errors.New(storage.ErrUnavailable))
+	}
+	rateLimiter, err := limiter.GetManager().AccessLimiter(checkDTO.Key, checkDTO.Args)
+	if err != nil {
+		return degradedCheck(accessError(err))
+	}
+	allowed, headers, err := (*rateLimiter).Peek(checkDTO.cost())
+	if err != nil {
+		return degradedCheck(err)
 	}
-	allowed, headers := (*rateLimiter).Check()
 	return allowed, headers, nil
 }
+
+// degradedCheck answers a check that failed with err. Checks failing because
+// storage is unavailable are allowed in fail-open mode, every other failure
+// is returned.
+func degradedCheck(err error) (bool, map[string]string, error) {
+	if err.Error() == storage.ErrUnavailable && config.DEGRADED_MODE == DEGRADED_MODE_FAIL_OPEN {
+		return true, nil, nil
+	}
+	return false, nil, err
+}
+
+// accessError reports keys without a configuration as a missing rate limiter.
+func accessError(err error) error {
+	if err.Error() == "key not configured" || err.Error() == "rate limiter not configured" {
+		return errors.New("rate limiter not found")
+	}
+	return err
+}
@@ -2,16 +2,38 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"rate-limiting-service/internal/limiter"
+
+	"github.com/go-playground/validator/v10"
 )
 
+// ConfigureDTO keys can't contain '#' or '@', which name sub-limits and
+// overrides, nor ':', which joins a key to its args in the keys limiters
+// store their state under, so deleting one key can't wipe another's state.
 type ConfigureDTO struct {
-	Key           string              `json:"key" validate:"required" message:"Valid key is required"`
+	Key           string              `json:"key" validate:"required,excludesall=#@:" message:"Valid key is required"`
 	LimiterType   limiter.LimiterType `json:"limiterType" validate:"required"`
 	Configuration json.RawMessage     `json:"configuration" validate:"required" message:"configuration key is required"`
+	Consistency   string              `json:"consistency" validate:"omitempty,oneof=eventual strict" message:"consistency must be eventual or strict"`
+	// Author is recorded in the key's history, it is taken from the request
+	// rather than the body.
+	Author string `json:"-"`
 }
 
+// Configure validates configDTO, as PUT /configure/:key takes the key from
+// the path, and stores it.
 func Configure(configDTO *ConfigureDTO) error {
+	if err := validator.New().Struct(configDTO); err != nil {
+		return err
+	}
+	if !limiter.IsValidLimiterType(configDTO.LimiterType) {
+		return errors.New("unknown limiter type")
+	}
+	if configDTO.Consistency == limiter.CONSISTENCY_STRICT && !limiter.SupportsStrictConsistency(configDTO.LimiterType) {
+		return errors.New("strict consistency is not supported by this limiter type")
+	}
+	previous, _ := limiter.GetConfiguration(configDTO.Key)
 
 	rateLimiter := limiter.NewLimiter(configDTO.Key, []string{}, configDTO.LimiterType)
 
@@ -19,5 +41,78 @@ func Configure(configDTO *ConfigureDTO) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	err = limiter.SaveRawConfiguration(configDTO.Key, configDTO.Configuration)
+	if err != nil {
+		return err
+	}
+	err = limiter.SaveConsistency(configDTO.Key, configDTO.Consistency)
+	if err != nil {
+		return err
+	}
+	limiter.ConfigurationChanged(configDTO.Key)
+	_, err = limiter.RecordConfigurationVersion(configDTO.Key, configDTO.Author, previous, &limiter.Configuration{
+		Key:           configDTO.Key,
+		LimiterType:   configDTO.LimiterType,
+		Configuration: configDTO.Configuration,
+		Consistency:   consistency(configDTO.Consistency),
+	})
+	return err
+}
+
+func consistency(consistency string) string {
+	if consistency == "" {
+		return limiter.CONSISTENCY_EVENTUAL
+	}
+	return consistency
+}
+
+// ConfigurationDTO is the body of PUT /configure/:key, which takes the key
+// from the path.
+type ConfigurationDTO struct {
+	LimiterType   limiter.LimiterType `json:"limiterType" validate:"required"`
+	Configuration json.RawMessage     `json:"configuration" validate:"required" message:"configuration key is required"`
+	Consistency   string              `json:"consistency" validate:"omitempty,oneof=eventual strict" message:"consistency must be eventual or strict"`
+}
+
+type ListConfigurationsDTO struct {
+	Prefix string `query:"prefix"`
+	Cursor uint64 `query:"cursor"`
+	Count  int64  `query:"count" validate:"omitempty,min=1,max=1000" message:"count must be between 1 and 1000"`
+}
+
+type ListConfigurationsResponse struct {
+	Configurations []limiter.Configuration `json:"configurations"`
+	Cursor         uint64                  `json:"cursor"`
+}
+
+func GetConfiguration(key string) (*limiter.Configuration, error) {
+	return limiter.GetConfiguration(key)
+}
+
+func ListConfigurations(listDTO *ListConfigurationsDTO) (*ListConfigurationsResponse, error) {
+	count := listDTO.Count
+	if count == 0 {
+		count = 100
+	}
+	configurations, cursor, err := limiter.ListConfigurations(listDTO.Prefix, listDTO.Cursor, count)
+	if err != nil {
+		return nil, err
+	}
+	return &ListConfigurationsResponse{
+		Configurations: configurations,
+		Cursor:         cursor,
+	}, nil
+}
+
+func DeleteConfiguration(key string, author string) error {
+	previous, err := limiter.GetConfiguration(key)
+	if err != nil {
+		return err
+	}
+	err = limiter.DeleteConfiguration(key)
+	if err != nil {
+		return err
+	}
+	_, err = limiter.RecordConfigurationVersion(key, author, previous, nil)
+	return err
 }
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"rate-limiting-service/internal/limiter"
+)
+
+type RollbackDTO struct {
+	Version int64 `query:"version" validate:"required,min=1" message:"version is required"`
+}
+
+func GetConfigurationHistory(key string) ([]limiter.ConfigurationVersion, error) {
+	versions, err := limiter.GetConfigurationHistory(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("key has no history")
+	}
+	return versions, nil
+}
+
+// RollbackConfiguration configures key as it was at the given version. The
+// rollback is itself recorded as a new version.
+func RollbackConfiguration(key string, rollbackDTO *RollbackDTO, author string) error {
+	version, err := limiter.GetConfigurationVersion(key, rollbackDTO.Version)
+	if err != nil {
+		return err
+	}
+	if version.Deleted {
+		return errors.New("version is a deletion")
+	}
+	return Configure(&ConfigureDTO{
+		Key:           key,
+		LimiterType:   version.LimiterType,
+		Configuration: version.Configuration,
+		Consistency:   version.Consistency,
+		Author:        author,
+	})
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"rate-limiting-service/internal/limiter"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// LIMITS_FILE_AUTHOR is the author recorded for changes made by the limits
+// file.
+const LIMITS_FILE_AUTHOR = "limits-file"
+
+// LimitsFile maps each key to its configuration, e.g.
+//
+//	api:
+//	  limiterType: 10
+//	  configuration: {capacity: 100, refillRate: 10}
+//	  overrides:
+//	    - name: enterprise
+//	      argIndex: 0
+//	      match: "enterprise-*"
+//	      limiterType: 10
+//	      configuration: {capacity: 1000, refillRate: 100}
+//
+// JSON files are read the same way.
+type LimitsFile map[string]LimitsFileEntry
+
+type LimitsFileEntry struct {
+	LimiterType   limiter.LimiterType `json:"limiterType" validate:"required"`
+	Configuration json.RawMessage     `json:"configuration" validate:"required" message:"configuration key is required"`
+	Consistency   string              `json:"consistency" validate:"omitempty,oneof=eventual strict" message:"consistency must be eventual or strict"`
+	Overrides     []OverrideDTO       `json:"overrides" validate:"dive"`
+}
+
+func ReadLimitsFile(path string) (LimitsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Configurations are handed to the limiters as JSON, so the YAML is
+	// converted once up front.
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	limits := LimitsFile{}
+	if err := json.Unmarshal(jsonData, &limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// Validate runs every configuration in the file through the same checks as
+// /configure without storing anything.
+func (limits LimitsFile) Validate() error {
+	validate := validator.New()
+	var errs []error
+	for _, key := range limits.keys() {
+		entry := limits[key]
+		configureDTO := ConfigureDTO{Key: key, LimiterType: entry.LimiterType, Configuration: entry.Configuration, Consistency: entry.Consistency}
+		if err := validate.Struct(configureDTO); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if err := validate.Struct(entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if err := limiter.ValidateConfiguration(entry.LimiterType, entry.Configuration); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		if entry.Consistency == limiter.CONSISTENCY_STRICT && !limiter.SupportsStrictConsistency(entry.LimiterType) {
+			errs = append(errs, fmt.Errorf("%s: strict consistency is not supported by this limiter type", key))
+		}
+		for _, override := range entry.Overrides {
+			if err := limiter.ValidateConfiguration(override.LimiterType, override.Configuration); err != nil {
+				errs = append(errs, fmt.Errorf("%s@%s: %w", key, override.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Apply configures the keys and overrides of the file whose stored
+// configuration differs, and removes those that were in previous but are no
+// longer in the file. Keys configured through the API are left alone.
+func (limits LimitsFile) Apply(previous LimitsFile) error {
+	for _, key := range limits.keys() {
+		entry := limits[key]
+		if !isConfigured(key, entry.LimiterType, entry.Configuration, entry.Consistency) {
+			err := Configure(&ConfigureDTO{
+				Key:           key,
+				LimiterType:   entry.LimiterType,
+				Configuration: entry.Configuration,
+				Consistency:   entry.Consistency,
+				Author:        LIMITS_FILE_AUTHOR,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		for _, override := range entry.Overrides {
+			if isOverrideConfigured(key, override) {
+				continue
+			}
+			if err := ConfigureOverride(key, &override); err != nil {
+				return fmt.Errorf("%s@%s: %w", key, override.Name, err)
+			}
+		}
+	}
+	for _, key := range previous.keys() {
+		entry, exists := limits[key]
+		if !exists {
+			if err := DeleteConfiguration(key, LIMITS_FILE_AUTHOR); err != nil && err.Error() != "key not configured" {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		for _, override := range previous[key].Overrides {
+			if entry.hasOverride(override.Name) {
+				continue
+			}
+			if err := DeleteOverride(key, override.Name); err != nil && err.Error() != "override not found" {
+				return fmt.Errorf("%s@%s: %w", key, override.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// WatchLimitsFile applies the file again whenever it is modified. A file
+// that fails to read or validate is reported and skipped, the limits applied
+// last stay in place.
+func WatchLimitsFile(path string, applied LimitsFile, interval time.Duration) {
+	info, err := os.Stat(path)
+	var modified time.Time
+	if err == nil {
+		modified = info.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			limits, err := ReadLimitsFile(path)
+			if err == nil {
+				err = limits.Validate()
+			}
+			if err == nil {
+				err = limits.Apply(applied)
+			}
+			if err != nil {
+				fmt.Println("limits file error:", err)
+				continue
+			}
+			applied = limits
+			fmt.Println("Limits file reloaded:", path)
+		}
+	}()
+}
+
+func (limits LimitsFile) keys() []string {
+	keys := make([]string, 0, len(limits))
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (entry LimitsFileEntry) hasOverride(name string) bool {
+	for _, override := range entry.Overrides {
+		if override.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isConfigured(key string, limiterType limiter.LimiterType, configuration json.RawMessage, consistencyMode string) bool {
+	stored, err := limiter.GetConfiguration(key)
+	if err != nil {
+		return false
+	}
+	return stored.LimiterType == limiterType &&
+		consistency(stored.Consistency) == consistency(consistencyMode) &&
+		sameJSON(stored.Configuration, configuration)
+}
+
+func isOverrideConfigured(key string, overrideDTO OverrideDTO) bool {
+	overrides, err := limiter.GetOverridesForKey(key)
+	if err != nil {
+		return false
+	}
+	for _, override := range overrides {
+		if override.Name != overrideDTO.Name {
+			continue
+		}
+		return override.ArgIndex == overrideDTO.ArgIndex &&
+			override.Match == overrideDTO.Match &&
+			override.Priority == overrideDTO.Priority &&
+			isConfigured(limiter.OverrideConfigKey(key, override.Name), overrideDTO.LimiterType, overrideDTO.Configuration, "")
+	}
+	return false
+}
+
+// sameJSON compares two JSON documents regardless of formatting and key
+// order.
+func sameJSON(a json.RawMessage, b json.RawMessage) bool {
+	var valueA, valueB any
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return false
+	}
+	normalizedA, _ := json.Marshal(valueA)
+	normalizedB, _ := json.Marshal(valueB)
+	return string(normalizedA) == string(normalizedB)
+}
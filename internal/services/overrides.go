@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"rate-limiting-service/internal/limiter"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// OverrideDTO names follow the rule of ConfigureDTO keys, the override being
+// configured under "<key>@<name>".
+type OverrideDTO struct {
+	Name          string              `json:"name" validate:"required,excludesall=#@:" message:"Valid name is required"`
+	ArgIndex      int                 `json:"argIndex" validate:"min=0" message:"argIndex must not be negative"`
+	Match         string              `json:"match" validate:"required" message:"match pattern is required"`
+	Priority      int                 `json:"priority"`
+	LimiterType   limiter.LimiterType `json:"limiterType" validate:"required"`
+	Configuration json.RawMessage     `json:"configuration" validate:"required" message:"configuration key is required"`
+}
+
+func ConfigureOverride(key string, overrideDTO *OverrideDTO) error {
+	if err := validator.New().Struct(overrideDTO); err != nil {
+		return err
+	}
+	if _, err := limiter.GetLimiterTypeForKey(key); err != nil {
+		return err
+	}
+	if !limiter.IsValidLimiterType(overrideDTO.LimiterType) {
+		return errors.New("unknown limiter type")
+	}
+
+	overrideKey := limiter.OverrideConfigKey(key, overrideDTO.Name)
+	rateLimiter := limiter.NewLimiter(overrideKey, []string{}, overrideDTO.LimiterType)
+	err := rateLimiter.Configure(overrideDTO.Configuration)
+	if err != nil {
+		return err
+	}
+	err = limiter.SaveRawConfiguration(overrideKey, overrideDTO.Configuration)
+	if err != nil {
+		return err
+	}
+	return limiter.SaveOverride(key, limiter.Override{
+		Name:     overrideDTO.Name,
+		ArgIndex: overrideDTO.ArgIndex,
+		Match:    overrideDTO.Match,
+		Priority: overrideDTO.Priority,
+	})
+}
+
+func GetOverrides(key string) ([]limiter.Override, error) {
+	if _, err := limiter.GetLimiterTypeForKey(key); err != nil {
+		return nil, err
+	}
+	return limiter.GetOverridesForKey(key)
+}
+
+func DeleteOverride(key string, name string) error {
+	return limiter.DeleteOverride(key, name)
+}
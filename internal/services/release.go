@@ -0,0 +1,24 @@
+package services
+
+import (
+	"errors"
+	"rate-limiting-service/internal/limiter"
+)
+
+type ReleaseDTO struct {
+	Key     string   `query:"key" validate:"required" message:"Valid key is required"`
+	Args    []string `query:"args"`
+	LeaseId string   `query:"leaseId" validate:"required" message:"Valid leaseId is required"`
+}
+
+func Release(releaseDTO *ReleaseDTO) error {
+	rateLimiter, err := limiter.GetManager().AccessLimiter(releaseDTO.Key, releaseDTO.Args)
+	if err != nil {
+		return accessError(err)
+	}
+	concurrencyLimiter, ok := (*rateLimiter).(*limiter.ConcurrencyLimiter)
+	if !ok {
+		return errors.New("rate limiter does not support release")
+	}
+	return concurrencyLimiter.Release(releaseDTO.LeaseId)
+}
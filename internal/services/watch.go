@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"rate-limiting-service/internal/limiter"
+	"rate-limiting-service/internal/storage"
+	"strings"
+)
+
+// LimitUpdate is the configuration of a key as sent to watchers, nil once the
+// key is deleted.
+type LimitUpdate struct {
+	Key           string
+	Deleted       bool
+	Configuration *limiter.Configuration
+}
+
+// WatchLimits calls send with the configuration of every key starting with
+// prefix, then again whenever one of them changes on any instance, until ctx
+// is done or send fails.
+func WatchLimits(ctx context.Context, prefix string, send func(LimitUpdate) error) error {
+	// Subscribe first so no change made while listing is missed.
+	sub := storage.GetManager().SubscribeUpdates(limiter.CONFIGURE_UPDATES_CHANNEL)
+	defer sub.Close()
+
+	cursor := uint64(0)
+	for {
+		configurations, nextCursor, err := limiter.ListConfigurations(prefix, cursor, 100)
+		if err != nil {
+			return err
+		}
+		for i := range configurations {
+			if err := send(LimitUpdate{Key: configurations[i].Key, Configuration: &configurations[i]}); err != nil {
+				return err
+			}
+		}
+		if nextCursor == 0 {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var update limiter.ConfigurationUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				continue
+			}
+			if !strings.HasPrefix(update.Key, prefix) {
+				continue
+			}
+			limitUpdate := LimitUpdate{Key: update.Key, Deleted: update.Deleted}
+			if !update.Deleted {
+				configuration, err := limiter.GetConfiguration(update.Key)
+				if err != nil {
+					continue
+				}
+				limitUpdate.Configuration = configuration
+			}
+			if err := send(limitUpdate); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"rate-limiting-service/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// circuitBreaker stops sending commands to Redis once
+// CIRCUIT_BREAKER_FAILURE_THRESHOLD of them failed in a row to reach it, so
+// requests aren't held up by connection timeouts while it is down. Commands
+// fail right away with ErrUnavailable until a ping gets through again, at
+// which point the reconnect callbacks are run.
+type circuitBreaker struct {
+	lock        sync.Mutex
+	client      redis.UniversalClient
+	failures    int
+	open        bool
+	onReconnect []func()
+}
+
+type probeContextKey struct{}
+
+func newCircuitBreaker(client redis.UniversalClient) *circuitBreaker {
+	breaker := &circuitBreaker{client: client}
+	client.AddHook(breaker)
+	return breaker
+}
+
+func (b *circuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *circuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if b.isOpen() && ctx.Value(probeContextKey{}) == nil {
+			cmd.SetErr(errors.New(ErrUnavailable))
+			return cmd.Err()
+		}
+		if err := b.record(next(ctx, cmd)); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return nil
+	}
+}
+
+func (b *circuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if b.isOpen() && ctx.Value(probeContextKey{}) == nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(errors.New(ErrUnavailable))
+			}
+			return errors.New(ErrUnavailable)
+		}
+		return b.record(next(ctx, cmds))
+	}
+}
+
+// record counts err towards opening the breaker when it means Redis couldn't
+// be reached, and returns it as ErrUnavailable in that case. Errors replied
+// by Redis itself, and missing keys, are returned as they are.
+func (b *circuitBreaker) record(err error) error {
+	if err != nil && !isUnreachable(err) {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err == nil {
+		b.failures = 0
+		return nil
+	}
+	b.failures++
+	if !b.open && b.failures >= config.CIRCUIT_BREAKER_FAILURE_THRESHOLD {
+		b.open = true
+		go b.probe()
+	}
+	return errors.New(ErrUnavailable)
+}
+
+func isUnreachable(err error) bool {
+	if err == redis.Nil {
+		return false
+	}
+	var redisError redis.Error
+	return !errors.As(err, &redisError)
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.open
+}
+
+// trip opens the breaker right away, for a Redis that can't be reached from
+// the start.
+func (b *circuitBreaker) trip() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.open {
+		b.open = true
+		go b.probe()
+	}
+}
+
+// probe pings Redis until it answers, then closes the breaker.
+func (b *circuitBreaker) probe() {
+	ctx := context.WithValue(context.Background(), probeContextKey{}, true)
+	ticker := time.NewTicker(time.Millisecond * config.CIRCUIT_BREAKER_RETRY_INTERVAL_IN_MS)
+	defer ticker.Stop()
+	for range ticker.C {
+		if b.client.Ping(ctx).Err() == nil {
+			break
+		}
+	}
+	b.lock.Lock()
+	b.open = false
+	b.failures = 0
+	callbacks := append([]func(){}, b.onReconnect...)
+	b.lock.Unlock()
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+func (b *circuitBreaker) addReconnectCallback(callback func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.onReconnect = append(b.onReconnect, callback)
+}
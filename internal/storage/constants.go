@@ -2,8 +2,11 @@ package storage
 
 const (
 	ErrDataNotFound = "data not found"
+	ErrUnavailable  = "storage unavailable"
 )
 
 const (
 	CONFIGURATION_LIMITER_TYPE_KEY = "limiterType"
+	CONFIGURATION_RAW_KEY          = "configuration"
+	CONFIGURATION_CONSISTENCY_KEY  = "consistency"
 )
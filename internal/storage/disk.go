@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journal persists the memory backend to a log-structured file. Every change
+// appends the new value of the key it touched, and the file is replayed on
+// startup, the last record of a key winning. Once the records of overwritten
+// values outweigh the live ones the file is compacted into a snapshot.
+//
+// Records are written as they happen, so they survive the process stopping,
+// and flushed to disk every JOURNAL_SYNC_INTERVAL.
+type journal struct {
+	file *os.File
+	path string
+	// written counts the bytes appended since the file was last compacted,
+	// live the bytes the snapshot held then.
+	written int64
+	live    int64
+	dirty   bool
+}
+
+const (
+	JOURNAL_SYNC_INTERVAL = time.Second
+	// Compaction waits for the file to reach this size, small files aren't
+	// worth rewriting.
+	JOURNAL_MIN_COMPACTION_SIZE = 1 << 20
+)
+
+const (
+	journalHash   = "hash"
+	journalList   = "list"
+	journalWindow = "window"
+	journalLeases = "leases"
+)
+
+// journalRecord holds the value of one key, a record without a value
+// deleting it.
+type journalRecord struct {
+	Kind      string                  `json:"kind"`
+	Key       string                  `json:"key"`
+	Hash      map[string]string       `json:"hash,omitempty"`
+	ExpiresAt int64                   `json:"expiresAt,omitempty"`
+	List      []string                `json:"list,omitempty"`
+	Window    []int64                 `json:"window,omitempty"`
+	Leases    map[string]journalLease `json:"leases,omitempty"`
+}
+
+type journalLease struct {
+	Weight    int   `json:"weight"`
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// NewDiskManager returns a memory backend restored from, and persisted to,
+// the file at path. It suits single-node deployments that have to keep their
+// limits and quotas across restarts without Redis.
+func NewDiskManager(path string) (StorageManager, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	sm := newMemoryManager()
+	if err := sm.replay(path); err != nil {
+		return nil, err
+	}
+	sm.journal = &journal{path: path}
+	if err := sm.compact(); err != nil {
+		return nil, err
+	}
+	go sm.syncJournal()
+	return sm, nil
+}
+
+// replay loads the records of the file at path, if it exists. Only the last
+// record can be cut short, by a crash while it was written, and it is dropped.
+// A malformed record before it means the file is corrupted.
+func (sm *memoryManager) replay(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	now := time.Now()
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		var record journalRecord
+		if unmarshalErr := json.Unmarshal(line, &record); unmarshalErr != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("journal %s corrupted at line %d: %w", path, lineNumber, unmarshalErr)
+		}
+		sm.restore(record, now)
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (sm *memoryManager) restore(record journalRecord, now time.Time) {
+	switch record.Kind {
+	case journalHash:
+		delete(sm.hashes, record.Key)
+		delete(sm.expirations, record.Key)
+		if len(record.Hash) == 0 {
+			return
+		}
+		if record.ExpiresAt != 0 {
+			expiresAt := time.Unix(0, record.ExpiresAt)
+			if now.After(expiresAt) {
+				return
+			}
+			sm.expirations[record.Key] = expiresAt
+		}
+		sm.hashes[record.Key] = record.Hash
+	case journalList:
+		delete(sm.lists, record.Key)
+		if len(record.List) > 0 {
+			sm.lists[record.Key] = record.List
+		}
+	case journalWindow:
+		delete(sm.windows, record.Key)
+		delete(sm.expirations, record.Key)
+		if len(record.Window) == 0 {
+			return
+		}
+		if record.ExpiresAt != 0 {
+			expiresAt := time.Unix(0, record.ExpiresAt)
+			if now.After(expiresAt) {
+				return
+			}
+			sm.expirations[record.Key] = expiresAt
+		}
+		sm.windows[record.Key] = record.Window
+	case journalLeases:
+		delete(sm.leases, record.Key)
+		if len(record.Leases) > 0 {
+			leases := map[string]memoryLease{}
+			for id, lease := range record.Leases {
+				if expiresAt := time.Unix(0, lease.ExpiresAt); now.Before(expiresAt) {
+					leases[id] = memoryLease{weight: lease.Weight, expiresAt: expiresAt}
+				}
+			}
+			if len(leases) > 0 {
+				sm.leases[record.Key] = leases
+			}
+		}
+	}
+}
+
+// persist appends the current value of key to the journal, if the manager
+// has one. The lock must be held. The change is kept in memory when it can't
+// be written, and saved by the next compaction.
+func (sm *memoryManager) persist(kind string, key string) error {
+	if sm.journal == nil {
+		return nil
+	}
+	if sm.journal.file == nil {
+		// The last write or compaction failed, a new snapshot saves this
+		// change along with the others.
+		return sm.compact()
+	}
+	record := journalRecord{Kind: kind, Key: key}
+	switch kind {
+	case journalHash:
+		record.Hash = sm.hashes[key]
+		if expiresAt, exists := sm.expirations[key]; exists {
+			record.ExpiresAt = expiresAt.UnixNano()
+		}
+	case journalList:
+		record.List = sm.lists[key]
+	case journalWindow:
+		record.Window = sm.windows[key]
+		if expiresAt, exists := sm.expirations[key]; exists {
+			record.ExpiresAt = expiresAt.UnixNano()
+		}
+	case journalLeases:
+		if leases := sm.leases[key]; len(leases) > 0 {
+			record.Leases = map[string]journalLease{}
+			for id, lease := range leases {
+				record.Leases[id] = journalLease{Weight: lease.weight, ExpiresAt: lease.expiresAt.UnixNano()}
+			}
+		}
+	}
+	data, _ := json.Marshal(record)
+	n, err := sm.journal.file.Write(append(data, '\n'))
+	sm.journal.written += int64(n)
+	sm.journal.dirty = true
+	if err != nil {
+		// A record written in part would corrupt the ones after it, the
+		// journal is rewritten instead.
+		sm.journal.file.Close()
+		sm.journal.file = nil
+		return err
+	}
+	if sm.journal.written > max(sm.journal.live, JOURNAL_MIN_COMPACTION_SIZE) {
+		return sm.compact()
+	}
+	return nil
+}
+
+// compact rewrites the journal as a snapshot of the current values. The lock
+// must be held, or the manager not shared yet.
+func (sm *memoryManager) compact() error {
+	tmpPath := sm.journal.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	size := int64(0)
+	write := func(record journalRecord) {
+		data, _ := json.Marshal(record)
+		n, _ := writer.Write(append(data, '\n'))
+		size += int64(n)
+	}
+	now := time.Now()
+	for key, hash := range sm.hashes {
+		record := journalRecord{Kind: journalHash, Key: key, Hash: hash}
+		if expiresAt, exists := sm.expirations[key]; exists {
+			if now.After(expiresAt) {
+				continue
+			}
+			record.ExpiresAt = expiresAt.UnixNano()
+		}
+		write(record)
+	}
+	for key, list := range sm.lists {
+		write(journalRecord{Kind: journalList, Key: key, List: list})
+	}
+	for key, window := range sm.windows {
+		if len(window) == 0 {
+			continue
+		}
+		record := journalRecord{Kind: journalWindow, Key: key, Window: window}
+		if expiresAt, exists := sm.expirations[key]; exists {
+			if now.After(expiresAt) {
+				continue
+			}
+			record.ExpiresAt = expiresAt.UnixNano()
+		}
+		write(record)
+	}
+	for key, leases := range sm.leases {
+		record := journalRecord{Kind: journalLeases, Key: key, Leases: map[string]journalLease{}}
+		for id, lease := range leases {
+			if now.Before(lease.expiresAt) {
+				record.Leases[id] = journalLease{Weight: lease.weight, ExpiresAt: lease.expiresAt.UnixNano()}
+			}
+		}
+		if len(record.Leases) > 0 {
+			write(record)
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, sm.journal.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if sm.journal.file != nil {
+		sm.journal.file.Close()
+	}
+	sm.journal.file, err = os.OpenFile(sm.journal.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		sm.journal.file = nil
+		return err
+	}
+	sm.journal.written = 0
+	sm.journal.live = size
+	sm.journal.dirty = false
+	return nil
+}
+
+// syncJournal flushes the records written since the last pass to disk.
+func (sm *memoryManager) syncJournal() {
+	ticker := time.NewTicker(JOURNAL_SYNC_INTERVAL)
+	for range ticker.C {
+		sm.lock.Lock()
+		if sm.journal.dirty && sm.journal.file != nil {
+			sm.journal.file.Sync()
+			sm.journal.dirty = false
+		}
+		sm.lock.Unlock()
+	}
+}
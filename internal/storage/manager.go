@@ -1,107 +1,149 @@
 package storage
 
 import (
-	"context"
-	"errors"
 	"fmt"
+	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/utils"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
-type StorageManager struct {
-	redisStorage *RedisStorage
-}
+// StorageManager keeps the limiter state, the configurations and carries the
+// updates limiters publish to each other.
+type StorageManager interface {
+	GetLimiterData(key string, out any) error
+	GetLimiterField(key string, field string) (string, error)
+	SetLimiterData(key string, data any, ttlInSeconds int) error
+	// DeleteLimiterData removes the limiter state stored at limiterKey and
+	// under it for every args.
+	DeleteLimiterData(limiterKey string) error
 
-var storageManager *StorageManager
+	GetConfigureData(key string, out any) error
+	GetConfigureType(key string) (int, error)
+	SetConfigureData(key string, limiterType int, data any) error
+	GetConfigureMap(key string) (map[string]string, error)
+	SetConfigureField(key string, field string, value string) error
+	// ListConfigureKeys returns a page of the configured keys starting with
+	// prefix and the cursor of the next page (0 once done).
+	ListConfigureKeys(prefix string, cursor uint64, count int64) ([]string, uint64, error)
+	// DeleteConfigureData removes the configurations and overrides of keys.
+	DeleteConfigureData(keys ...string) error
 
-func GetManager() *StorageManager {
-	if storageManager == nil {
-		storageManager = &StorageManager{
-			redisStorage: InitRedisStorage(),
-		}
-	}
-	return storageManager
-}
+	SetOverride(key string, name string, data []byte) error
+	GetOverrides(key string) (map[string]string, error)
+	DeleteOverride(key string, name string) (bool, error)
 
-func (sm *StorageManager) GetLimiterData(key string, out any) error {
-	data, err := sm.redisStorage.client.HGetAll(context.Background(), key).Result()
-	if err != nil && err.Error() == "redis: nil" {
-		return errors.New(ErrDataNotFound)
-	}
-	if len(data) == 0 {
-		return errors.New(ErrDataNotFound)
-	}
-	if err != nil {
-		return err
-	}
-	return utils.MapToStruct(data, out)
-}
+	// AppendConfigureHistory adds a version to the history of key and returns
+	// its number, starting at 1.
+	AppendConfigureHistory(key string, data []byte) (int64, error)
+	GetConfigureHistory(key string) ([]string, error)
+	GetConfigureVersion(key string, version int64) (string, error)
 
-func (sm *StorageManager) GetLimiterField(key string, field string) (string, error) {
-	data, err := sm.redisStorage.client.HGet(context.Background(), key, field).Result()
-	if err != nil && err.Error() == "redis: nil" {
-		return "", errors.New(ErrDataNotFound)
-	}
-	if err != nil {
-		return "", err
-	}
-	return data, nil
-}
+	// AcquireLease adds leaseId, weighing cost slots, to the in-flight leases
+	// stored at key if that keeps the slots in use within limit. It returns
+	// whether the lease was acquired along with the number of slots in use.
+	AcquireLease(key string, leaseId string, cost int, limit int, ttl time.Duration) (bool, int, error)
+	// ReleaseLease removes leaseId from the in-flight leases stored at key.
+	ReleaseLease(key string, leaseId string) (bool, error)
+
+	// TakeTokens refills the token bucket stored at key and takes cost tokens
+	// from it if there are enough, in one atomic step. A negative cost gives
+	// tokens back. It returns whether the tokens were taken and how many are
+	// left.
+	TakeTokens(key string, capacity float64, refillRate float64, cost int) (bool, float64, error)
+	// AddToWindow logs cost requests in the sliding window stored at key if
+	// that keeps it within capacity, in one atomic step. The requests are
+	// logged as member followed by ':' and their index from 1. It returns
+	// whether they were logged, the requests in the window and the time until
+	// the oldest of them leaves it.
+	AddToWindow(key string, capacity int, windowSize time.Duration, cost int, member string) (bool, int, time.Duration, error)
+	// RemoveFromWindow drops the requests logged as members from the sliding
+	// window stored at key.
+	RemoveFromWindow(key string, members []string) error
+	// GetWindowLog returns the timestamps, in nanoseconds and oldest first,
+	// logged in the sliding window stored at key after since.
+	GetWindowLog(key string, since time.Time) ([]int64, error)
+	// AddToWindowLog logs members, named by NewWindowMember, in the sliding
+	// window stored at key, drops the ones up to cutoff and keeps the window
+	// for ttl.
+	AddToWindowLog(key string, members []string, cutoff time.Time, ttl time.Duration) error
+	// MigrateWindowLog seeds the sliding window at key, if it doesn't exist
+	// yet, from a log stored the old way: a JSON array in the "requestLog"
+	// field of the hash at legacyKey. The hash is left in place so instances
+	// still writing it keep working during a rollout.
+	MigrateWindowLog(legacyKey string, key string) error
 
-func (sm *StorageManager) SetLimiterData(key string, data any, ttlInSeconds int) {
-	ttl := time.Second * time.Duration(ttlInSeconds)
-	values := utils.StructToMap(data)
-	err := sm.redisStorage.client.HSet(context.Background(), key, values).Err()
-	if err != nil {
-		panic(err)
-	}
-	sm.redisStorage.client.Expire(context.Background(), key, ttl)
+	PublishUpdates(channel string, data any)
+	SubscribeUpdates(channel string) Subscription
+
+	// Available reports whether the storage can currently be reached. While
+	// it can't, every call fails with ErrUnavailable except for reads of the
+	// configurations and overrides, which return the ones last read.
+	Available() bool
+	// OnReconnect registers callback to run once the storage can be reached
+	// again after being unavailable.
+	OnReconnect(callback func())
 }
 
-func (sm *StorageManager) GetConfigureData(key string, out any) error {
-	storageKey := fmt.Sprintf("configure:%s", key)
-	data, err := sm.redisStorage.client.HGetAll(context.Background(), storageKey).Result()
-	if err != nil && err.Error() == "redis: nil" {
-		return errors.New(ErrDataNotFound)
-	}
-	if len(data) == 0 {
-		return errors.New(ErrDataNotFound)
-	}
-	if err != nil {
-		return err
-	}
-	return utils.MapToStruct(data, out)
+// Subscription delivers the messages published on a channel until closed.
+type Subscription interface {
+	Channel() <-chan *Message
+	Close() error
 }
 
-func (sm *StorageManager) GetConfigureType(key string) (int, error) {
-	storageKey := fmt.Sprintf("configure:%s", key)
-	data, err := sm.redisStorage.client.HGet(context.Background(), storageKey, CONFIGURATION_LIMITER_TYPE_KEY).Result()
-	if err != nil && err.Error() == "redis: nil" {
-		return 0, errors.New(ErrDataNotFound)
-	}
-	if err != nil {
-		return 0, err
-	}
-	return strconv.Atoi(data)
+type Message struct {
+	Channel string
+	Payload string
 }
 
-func (sm *StorageManager) SetConfigureData(key string, limiterType int, data any) {
-	storageKey := fmt.Sprintf("configure:%s", key)
-	values := utils.StructToMap(data)
-	values[CONFIGURATION_LIMITER_TYPE_KEY] = limiterType
-	err := sm.redisStorage.client.HSet(context.Background(), storageKey, values).Err()
-	if err != nil {
-		panic(err)
-	}
+const (
+	STORAGE_BACKEND_REDIS  = "redis"
+	STORAGE_BACKEND_MEMORY = "memory"
+	STORAGE_BACKEND_DISK   = "disk"
+)
+
+var (
+	storageManager StorageManager
+	// storageOnce keeps concurrent first calls from opening the storage twice,
+	// which the disk backend can't share.
+	storageOnce sync.Once
+)
+
+// GetManager returns the storage selected by STORAGE_BACKEND. The memory
+// backend keeps everything in this process and suits a single instance, the
+// disk backend does the same and persists it to DISK_STORAGE_PATH.
+func GetManager() StorageManager {
+	storageOnce.Do(func() {
+		switch config.STORAGE_BACKEND {
+		case STORAGE_BACKEND_REDIS:
+			storageManager = newRedisManager()
+		case STORAGE_BACKEND_MEMORY:
+			storageManager = newMemoryManager()
+		case STORAGE_BACKEND_DISK:
+			diskManager, err := NewDiskManager(config.DISK_STORAGE_PATH)
+			if err != nil {
+				panic("disk storage not opened: " + err.Error())
+			}
+			storageManager = diskManager
+		default:
+			panic("unknown storage backend: " + config.STORAGE_BACKEND)
+		}
+	})
+	return storageManager
 }
 
-func (sm *StorageManager) PublishUpdates(channel string, data any) {
-	sm.redisStorage.client.Publish(context.Background(), channel, data)
+// NewWindowMember names a request logged at timestamp, in nanoseconds, in a
+// sliding window. Members have to be unique, the same request may be logged
+// on several instances within one nanosecond.
+func NewWindowMember(timestamp int64) string {
+	return fmt.Sprintf("%d:%s", timestamp, utils.RandomString(8))
 }
 
-func (sm *StorageManager) SubscribeUpdates(channel string) *redis.PubSub {
-	return sm.redisStorage.client.Subscribe(context.Background(), channel)
+// WindowMemberTimestamp returns the timestamp member was logged at.
+func WindowMemberTimestamp(member string) int64 {
+	timestamp, _, _ := strings.Cut(member, ":")
+	value, _ := strconv.ParseInt(timestamp, 10, 64)
+	return value
 }
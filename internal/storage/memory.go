@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rate-limiting-service/internal/utils"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryManager keeps everything in this process. Values are stored as the
+// strings Redis would hold so limiters read back the same data from either.
+type memoryManager struct {
+	lock        sync.Mutex
+	hashes      map[string]map[string]string
+	expirations map[string]time.Time
+	lists       map[string][]string
+	windows     map[string][]int64
+	leases      map[string]map[string]memoryLease
+	subscribers map[string][]*memorySubscription
+	journal     *journal
+}
+
+type memoryLease struct {
+	weight    int
+	expiresAt time.Time
+}
+
+func newMemoryManager() *memoryManager {
+	sm := &memoryManager{
+		hashes:      map[string]map[string]string{},
+		expirations: map[string]time.Time{},
+		lists:       map[string][]string{},
+		windows:     map[string][]int64{},
+		leases:      map[string]map[string]memoryLease{},
+		subscribers: map[string][]*memorySubscription{},
+	}
+	go sm.removeExpired()
+	return sm
+}
+
+// NewMemoryManager returns a memory backend of its own, apart from the one
+// GetManager shares.
+func NewMemoryManager() StorageManager {
+	return newMemoryManager()
+}
+
+// removeExpired drops expired limiter state that is never read again, and
+// the leases that ran out.
+func (sm *memoryManager) removeExpired() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		sm.lock.Lock()
+		now := time.Now()
+		for key := range sm.expirations {
+			sm.expire(key, now)
+		}
+		for key, leases := range sm.leases {
+			for id, lease := range leases {
+				if !now.Before(lease.expiresAt) {
+					delete(leases, id)
+				}
+			}
+			if len(leases) == 0 {
+				delete(sm.leases, key)
+			}
+		}
+		sm.lock.Unlock()
+	}
+}
+
+// expire drops the hash or window stored at key once its TTL has passed, like
+// Redis expires a key whatever its type. The lock must be held.
+func (sm *memoryManager) expire(key string, now time.Time) {
+	if expiresAt, exists := sm.expirations[key]; exists && now.After(expiresAt) {
+		delete(sm.hashes, key)
+		delete(sm.windows, key)
+		delete(sm.expirations, key)
+	}
+}
+
+// hash returns the hash stored at key, nil if missing or expired. The lock
+// must be held.
+func (sm *memoryManager) hash(key string) map[string]string {
+	sm.expire(key, time.Now())
+	return sm.hashes[key]
+}
+
+// window returns the window stored at key, nil if missing or expired. The
+// lock must be held.
+func (sm *memoryManager) window(key string) []int64 {
+	sm.expire(key, time.Now())
+	return sm.windows[key]
+}
+
+// setFields merges values into the hash at key. The lock must be held.
+func (sm *memoryManager) setFields(key string, values map[string]any) {
+	data := sm.hash(key)
+	if data == nil {
+		data = map[string]string{}
+		sm.hashes[key] = data
+	}
+	for field, value := range values {
+		data[field] = formatValue(value)
+	}
+}
+
+// getHash returns a copy of the hash at key.
+func (sm *memoryManager) getHash(key string) (map[string]string, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	data := sm.hash(key)
+	if len(data) == 0 {
+		return nil, errors.New(ErrDataNotFound)
+	}
+	result := make(map[string]string, len(data))
+	for field, value := range data {
+		result[field] = value
+	}
+	return result, nil
+}
+
+func (sm *memoryManager) getField(key string, field string) (string, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	value, exists := sm.hash(key)[field]
+	if !exists {
+		return "", errors.New(ErrDataNotFound)
+	}
+	return value, nil
+}
+
+// formatValue formats a value the way the Redis client writes it.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10)
+	}
+	return fmt.Sprint(value)
+}
+
+func (sm *memoryManager) GetLimiterData(key string, out any) error {
+	data, err := sm.getHash(key)
+	if err != nil {
+		return err
+	}
+	return utils.MapToStruct(data, out)
+}
+
+func (sm *memoryManager) GetLimiterField(key string, field string) (string, error) {
+	return sm.getField(key, field)
+}
+
+func (sm *memoryManager) SetLimiterData(key string, data any, ttlInSeconds int) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.setFields(key, utils.StructToMap(data))
+	sm.expirations[key] = time.Now().Add(time.Second * time.Duration(ttlInSeconds))
+	return sm.persist(journalHash, key)
+}
+
+func (sm *memoryManager) DeleteLimiterData(limiterKey string) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	var err error
+	for key := range sm.hashes {
+		if key == limiterKey || strings.HasPrefix(key, limiterKey+":") {
+			delete(sm.hashes, key)
+			delete(sm.expirations, key)
+			err = errors.Join(err, sm.persist(journalHash, key))
+		}
+	}
+	for key := range sm.windows {
+		if key == limiterKey || strings.HasPrefix(key, limiterKey+":") {
+			delete(sm.windows, key)
+			delete(sm.expirations, key)
+			err = errors.Join(err, sm.persist(journalWindow, key))
+		}
+	}
+	for key := range sm.leases {
+		if key == limiterKey || strings.HasPrefix(key, limiterKey+":") {
+			delete(sm.leases, key)
+			err = errors.Join(err, sm.persist(journalLeases, key))
+		}
+	}
+	return err
+}
+
+func (sm *memoryManager) GetConfigureData(key string, out any) error {
+	data, err := sm.getHash(fmt.Sprintf("configure:%s", key))
+	if err != nil {
+		return err
+	}
+	return utils.MapToStruct(data, out)
+}
+
+func (sm *memoryManager) GetConfigureType(key string) (int, error) {
+	data, err := sm.getField(fmt.Sprintf("configure:%s", key), CONFIGURATION_LIMITER_TYPE_KEY)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(data)
+}
+
+func (sm *memoryManager) SetConfigureData(key string, limiterType int, data any) error {
+	values := utils.StructToMap(data)
+	values[CONFIGURATION_LIMITER_TYPE_KEY] = limiterType
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.setFields(fmt.Sprintf("configure:%s", key), values)
+	return sm.persist(journalHash, fmt.Sprintf("configure:%s", key))
+}
+
+func (sm *memoryManager) GetConfigureMap(key string) (map[string]string, error) {
+	return sm.getHash(fmt.Sprintf("configure:%s", key))
+}
+
+func (sm *memoryManager) SetConfigureField(key string, field string, value string) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.setFields(fmt.Sprintf("configure:%s", key), map[string]any{field: value})
+	return sm.persist(journalHash, fmt.Sprintf("configure:%s", key))
+}
+
+// ListConfigureKeys pages through the configured keys in order, the cursor
+// being the position of the next page.
+func (sm *memoryManager) ListConfigureKeys(prefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	sm.lock.Lock()
+	keys := []string{}
+	for storageKey := range sm.hashes {
+		if key, found := strings.CutPrefix(storageKey, "configure:"); found && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sm.lock.Unlock()
+	sort.Strings(keys)
+	if cursor >= uint64(len(keys)) {
+		return []string{}, 0, nil
+	}
+	end := cursor + uint64(count)
+	if end >= uint64(len(keys)) {
+		return keys[cursor:], 0, nil
+	}
+	return keys[cursor:end], end, nil
+}
+
+func (sm *memoryManager) DeleteConfigureData(keys ...string) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	var err error
+	for _, key := range keys {
+		delete(sm.hashes, fmt.Sprintf("configure:%s", key))
+		delete(sm.hashes, fmt.Sprintf("overrides:%s", key))
+		err = errors.Join(err, sm.persist(journalHash, fmt.Sprintf("configure:%s", key)))
+		err = errors.Join(err, sm.persist(journalHash, fmt.Sprintf("overrides:%s", key)))
+	}
+	return err
+}
+
+func (sm *memoryManager) SetOverride(key string, name string, data []byte) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.setFields(fmt.Sprintf("overrides:%s", key), map[string]any{name: data})
+	return sm.persist(journalHash, fmt.Sprintf("overrides:%s", key))
+}
+
+func (sm *memoryManager) GetOverrides(key string) (map[string]string, error) {
+	data, err := sm.getHash(fmt.Sprintf("overrides:%s", key))
+	if err != nil {
+		return map[string]string{}, nil
+	}
+	return data, nil
+}
+
+func (sm *memoryManager) DeleteOverride(key string, name string) (bool, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	data := sm.hash(fmt.Sprintf("overrides:%s", key))
+	if _, exists := data[name]; !exists {
+		return false, nil
+	}
+	delete(data, name)
+	return true, sm.persist(journalHash, fmt.Sprintf("overrides:%s", key))
+}
+
+func (sm *memoryManager) AppendConfigureHistory(key string, data []byte) (int64, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	historyKey := fmt.Sprintf("configure-history:%s", key)
+	sm.lists[historyKey] = append(sm.lists[historyKey], string(data))
+	return int64(len(sm.lists[historyKey])), sm.persist(journalList, historyKey)
+}
+
+func (sm *memoryManager) GetConfigureHistory(key string) ([]string, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	historyKey := fmt.Sprintf("configure-history:%s", key)
+	return append([]string{}, sm.lists[historyKey]...), nil
+}
+
+func (sm *memoryManager) GetConfigureVersion(key string, version int64) (string, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	historyKey := fmt.Sprintf("configure-history:%s", key)
+	if version < 1 || version > int64(len(sm.lists[historyKey])) {
+		return "", errors.New(ErrDataNotFound)
+	}
+	return sm.lists[historyKey][version-1], nil
+}
+
+func (sm *memoryManager) AcquireLease(key string, leaseId string, cost int, limit int, ttl time.Duration) (bool, int, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	now := time.Now()
+	leases := sm.leases[key]
+	if leases == nil {
+		leases = map[string]memoryLease{}
+		sm.leases[key] = leases
+	}
+	used := 0
+	for id, lease := range leases {
+		if !now.Before(lease.expiresAt) {
+			delete(leases, id)
+			continue
+		}
+		used += lease.weight
+	}
+	if used+cost > limit {
+		return false, used, nil
+	}
+	leases[leaseId] = memoryLease{weight: cost, expiresAt: now.Add(ttl)}
+	if err := sm.persist(journalLeases, key); err != nil {
+		delete(leases, leaseId)
+		return false, used, err
+	}
+	return true, used + cost, nil
+}
+
+func (sm *memoryManager) ReleaseLease(key string, leaseId string) (bool, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if _, exists := sm.leases[key][leaseId]; !exists {
+		return false, nil
+	}
+	delete(sm.leases[key], leaseId)
+	return true, sm.persist(journalLeases, key)
+}
+
+func (sm *memoryManager) PublishUpdates(channel string, data any) {
+	sm.lock.Lock()
+	subscribers := append([]*memorySubscription{}, sm.subscribers[channel]...)
+	sm.lock.Unlock()
+	message := &Message{Channel: channel, Payload: formatValue(data)}
+	for _, sub := range subscribers {
+		sub.deliver(message)
+	}
+}
+
+// The memory backend lives in this process, so it is always available.
+func (sm *memoryManager) Available() bool {
+	return true
+}
+
+func (sm *memoryManager) OnReconnect(callback func()) {}
+
+func (sm *memoryManager) SubscribeUpdates(channel string) Subscription {
+	sub := &memorySubscription{
+		manager:  sm,
+		channel:  channel,
+		messages: make(chan *Message, 100),
+	}
+	sm.lock.Lock()
+	sm.subscribers[channel] = append(sm.subscribers[channel], sub)
+	sm.lock.Unlock()
+	return sub
+}
+
+type memorySubscription struct {
+	lock     sync.Mutex
+	manager  *memoryManager
+	channel  string
+	messages chan *Message
+	closed   bool
+}
+
+// deliver drops the message when the subscriber falls behind, like Redis
+// does with slow consumers.
+func (s *memorySubscription) deliver(message *Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.messages <- message:
+	default:
+	}
+}
+
+func (s *memorySubscription) Channel() <-chan *Message {
+	return s.messages
+}
+
+func (s *memorySubscription) Close() error {
+	s.manager.lock.Lock()
+	subscribers := s.manager.subscribers[s.channel]
+	for i, sub := range subscribers {
+		if sub == s {
+			s.manager.subscribers[s.channel] = append(subscribers[:i:i], subscribers[i+1:]...)
+			break
+		}
+	}
+	s.manager.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+	return nil
+}
+
+func (sm *memoryManager) TakeTokens(key string, capacity float64, refillRate float64, cost int) (bool, float64, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	now := time.Now()
+	data := sm.hash(key)
+	tokens, lastRefill := capacity, now
+	if data != nil {
+		tokens, _ = strconv.ParseFloat(data["tokens"], 64)
+		lastRefillNanos, _ := strconv.ParseInt(data["lastRefill"], 10, 64)
+		lastRefill = time.Unix(0, lastRefillNanos)
+	}
+	tokens = min(capacity, tokens+max(now.Sub(lastRefill).Seconds(), 0)*refillRate)
+	allowed := tokens >= float64(cost)
+	if allowed {
+		tokens = min(capacity, tokens-float64(cost))
+	}
+	sm.setFields(key, map[string]any{"tokens": tokens, "lastRefill": now.UnixNano()})
+	sm.expirations[key] = now.Add(time.Duration(capacity/refillRate*float64(time.Second)) + time.Second)
+	return allowed, tokens, sm.persist(journalHash, key)
+}
+
+// Sliding windows are kept as timestamps in nanoseconds, oldest first.
+func (sm *memoryManager) AddToWindow(key string, capacity int, windowSize time.Duration, cost int, member string) (bool, int, time.Duration, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	now := time.Now()
+	entries := trimWindow(sm.window(key), now.Add(-windowSize))
+	allowed := len(entries)+cost <= capacity
+	if allowed {
+		// Requests are logged at the timestamp of their member, so they can be
+		// removed by it.
+		timestamp := now.UnixNano()
+		if logged := WindowMemberTimestamp(member); logged > 0 {
+			timestamp = logged
+		}
+		i, _ := slices.BinarySearch(entries, timestamp+1)
+		entries = slices.Insert(entries, i, slices.Repeat([]int64{timestamp}, cost)...)
+		sm.expirations[key] = now.Add(windowSize)
+	}
+	sm.windows[key] = entries
+	reset := time.Duration(0)
+	if len(entries) > 0 {
+		reset = windowSize - now.Sub(time.Unix(0, entries[0]))
+	}
+	return allowed, len(entries), reset, sm.persist(journalWindow, key)
+}
+
+// RemoveFromWindow drops each member by the timestamp it starts with, as
+// windows only keep timestamps. Members missing from the window are skipped,
+// like Redis does.
+func (sm *memoryManager) RemoveFromWindow(key string, members []string) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	entries := sm.window(key)
+	removed := false
+	for _, member := range members {
+		if i := slices.Index(entries, WindowMemberTimestamp(member)); i >= 0 {
+			entries = slices.Delete(entries, i, i+1)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	sm.windows[key] = entries
+	return sm.persist(journalWindow, key)
+}
+
+func (sm *memoryManager) GetWindowLog(key string, since time.Time) ([]int64, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return append([]int64{}, trimWindow(sm.window(key), since)...), nil
+}
+
+func (sm *memoryManager) AddToWindowLog(key string, members []string, cutoff time.Time, ttl time.Duration) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	entries := sm.window(key)
+	for _, member := range members {
+		entries = append(entries, WindowMemberTimestamp(member))
+	}
+	slices.Sort(entries)
+	sm.windows[key] = trimWindow(entries, cutoff)
+	sm.expirations[key] = time.Now().Add(ttl)
+	return sm.persist(journalWindow, key)
+}
+
+func (sm *memoryManager) MigrateWindowLog(legacyKey string, key string) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if sm.window(key) != nil {
+		return nil
+	}
+	var timestamps []int64
+	if err := json.Unmarshal([]byte(sm.hash(legacyKey)["requestLog"]), &timestamps); err != nil {
+		return nil
+	}
+	slices.Sort(timestamps)
+	sm.windows[key] = timestamps
+	if expiresAt, exists := sm.expirations[legacyKey]; exists {
+		sm.expirations[key] = expiresAt
+	}
+	return sm.persist(journalWindow, key)
+}
+
+// trimWindow drops the timestamps up to cutoff from a sorted window.
+func trimWindow(entries []int64, cutoff time.Time) []int64 {
+	i, _ := slices.BinarySearch(entries, cutoff.UnixNano()+1)
+	return entries[i:]
+}
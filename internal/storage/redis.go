@@ -3,6 +3,9 @@ package storage
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"rate-limiting-service/internal/config"
@@ -11,10 +14,19 @@ import (
 )
 
 type RedisStorage struct {
-	client *redis.Client
+	client  redis.UniversalClient
+	breaker *circuitBreaker
 }
 
-// NewRedisStorage initializes and returns a RedisStorage instance.
+const (
+	REDIS_MODE_STANDALONE = "standalone"
+	REDIS_MODE_SENTINEL   = "sentinel"
+	REDIS_MODE_CLUSTER    = "cluster"
+)
+
+// NewRedisStorage initializes and returns a RedisStorage instance. REDIS_MODE
+// picks a single node, a master found through Sentinel or a Cluster, with
+// REDIS_ADDRESS listing the sentinels or cluster nodes separated by commas.
 func InitRedisStorage() *RedisStorage {
 
 	var tlsconfig *tls.Config = nil
@@ -23,18 +35,79 @@ func InitRedisStorage() *RedisStorage {
 			MinVersion: tls.VersionTLS12,
 		}
 	}
-	client := redis.NewClient(&redis.Options{
-		Addr:      config.REDIS_ADDRESS,
-		Username:  config.REDIS_USERNAME,
-		Password:  config.REDIS_PASSWORD,
-		TLSConfig: tlsconfig,
-	})
+	var client redis.UniversalClient
+	switch config.REDIS_MODE {
+	case REDIS_MODE_STANDALONE:
+		client = redis.NewClient(&redis.Options{
+			Addr:      config.REDIS_ADDRESS,
+			Username:  config.REDIS_USERNAME,
+			Password:  config.REDIS_PASSWORD,
+			TLSConfig: tlsconfig,
+		})
+	case REDIS_MODE_SENTINEL:
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.REDIS_MASTER_NAME,
+			SentinelAddrs:    strings.Split(config.REDIS_ADDRESS, ","),
+			SentinelPassword: config.REDIS_SENTINEL_PASSWORD,
+			Username:         config.REDIS_USERNAME,
+			Password:         config.REDIS_PASSWORD,
+			TLSConfig:        tlsconfig,
+		})
+	case REDIS_MODE_CLUSTER:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     strings.Split(config.REDIS_ADDRESS, ","),
+			Username:  config.REDIS_USERNAME,
+			Password:  config.REDIS_PASSWORD,
+			TLSConfig: tlsconfig,
+		})
+	default:
+		panic("unknown redis mode: " + config.REDIS_MODE)
+	}
+	redisStorage := &RedisStorage{
+		client:  client,
+		breaker: newCircuitBreaker(client),
+	}
+	// The service starts degraded rather than not at all, and picks Redis up
+	// once it can be reached.
 	if err := client.Ping(context.Background()).Err(); err != nil {
-		panic("redis not connected: " + err.Error())
+		fmt.Println("redis not connected:", err)
+		redisStorage.breaker.trip()
+	}
+	return redisStorage
+}
+
+// HashTag wraps key in braces in cluster mode, so that every storage key and
+// channel built from it hashes to the same slot and multi-key operations on
+// them stay slot-safe. Outside of a cluster keys are left as they were.
+func HashTag(key string) string {
+	if config.REDIS_MODE == REDIS_MODE_CLUSTER {
+		return "{" + key + "}"
+	}
+	return key
+}
+
+// scan calls fn with every key matching the pattern, on every master of a
+// cluster. Calls to fn never overlap.
+func (r *RedisStorage) scan(ctx context.Context, match string, fn func(key string) error) error {
+	var lock sync.Mutex
+	scanNode := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, match, 100).Iterator()
+		for iter.Next(ctx) {
+			lock.Lock()
+			err := fn(iter.Val())
+			lock.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
 	}
-	return &RedisStorage{
-		client: client,
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scanNode(ctx, client)
+		})
 	}
+	return scanNode(ctx, r.client)
 }
 
 // Set sets a key with a given value and TTL (time to live).
@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rate-limiting-service/internal/config"
+	"rate-limiting-service/internal/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisManager keeps everything in Redis, so limiters on every instance
+// sharing it see the same state. The configurations and overrides last read
+// are kept, and served while Redis can't be reached.
+type redisManager struct {
+	redisStorage *RedisStorage
+	lastKnown    map[string]map[string]string
+	lock         sync.Mutex
+}
+
+func newRedisManager() *redisManager {
+	return &redisManager{
+		redisStorage: InitRedisStorage(),
+		lastKnown:    map[string]map[string]string{},
+	}
+}
+
+func (sm *redisManager) Available() bool {
+	return !sm.redisStorage.breaker.isOpen()
+}
+
+func (sm *redisManager) OnReconnect(callback func()) {
+	sm.redisStorage.breaker.addReconnectCallback(callback)
+}
+
+// getHash reads the hash at storageKey, or the copy last read of it if Redis
+// can't be reached.
+func (sm *redisManager) getHash(storageKey string) (map[string]string, error) {
+	data, err := sm.redisStorage.client.HGetAll(context.Background(), storageKey).Result()
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if err != nil {
+		if lastKnown, exists := sm.lastKnown[storageKey]; exists && err.Error() == ErrUnavailable {
+			return lastKnown, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		delete(sm.lastKnown, storageKey)
+	} else {
+		sm.lastKnown[storageKey] = data
+	}
+	return data, nil
+}
+
+func (sm *redisManager) GetLimiterData(key string, out any) error {
+	data, err := sm.redisStorage.client.HGetAll(context.Background(), key).Result()
+	if err != nil && err.Error() == "redis: nil" {
+		return errors.New(ErrDataNotFound)
+	}
+	if len(data) == 0 {
+		return errors.New(ErrDataNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	return utils.MapToStruct(data, out)
+}
+
+func (sm *redisManager) GetLimiterField(key string, field string) (string, error) {
+	data, err := sm.redisStorage.client.HGet(context.Background(), key, field).Result()
+	if err != nil && err.Error() == "redis: nil" {
+		return "", errors.New(ErrDataNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+func (sm *redisManager) SetLimiterData(key string, data any, ttlInSeconds int) error {
+	ttl := time.Second * time.Duration(ttlInSeconds)
+	values := utils.StructToMap(data)
+	err := sm.redisStorage.client.HSet(context.Background(), key, values).Err()
+	if err != nil {
+		return err
+	}
+	return sm.redisStorage.client.Expire(context.Background(), key, ttl).Err()
+}
+
+func (sm *redisManager) GetConfigureData(key string, out any) error {
+	data, err := sm.getHash(configureKey(key))
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New(ErrDataNotFound)
+	}
+	return utils.MapToStruct(data, out)
+}
+
+func (sm *redisManager) GetConfigureType(key string) (int, error) {
+	data, err := sm.getHash(configureKey(key))
+	if err != nil {
+		return 0, err
+	}
+	limiterType, exists := data[CONFIGURATION_LIMITER_TYPE_KEY]
+	if !exists {
+		return 0, errors.New(ErrDataNotFound)
+	}
+	return strconv.Atoi(limiterType)
+}
+
+func (sm *redisManager) SetConfigureData(key string, limiterType int, data any) error {
+	storageKey := configureKey(key)
+	values := utils.StructToMap(data)
+	values[CONFIGURATION_LIMITER_TYPE_KEY] = limiterType
+	return sm.redisStorage.client.HSet(context.Background(), storageKey, values).Err()
+}
+
+func (sm *redisManager) PublishUpdates(channel string, data any) {
+	sm.redisStorage.client.Publish(context.Background(), channel, data)
+}
+
+func (sm *redisManager) SubscribeUpdates(channel string) Subscription {
+	return newRedisSubscription(sm.redisStorage.client.Subscribe(context.Background(), channel))
+}
+
+type redisSubscription struct {
+	pubsub   *redis.PubSub
+	messages chan *Message
+}
+
+func newRedisSubscription(pubsub *redis.PubSub) *redisSubscription {
+	sub := &redisSubscription{
+		pubsub:   pubsub,
+		messages: make(chan *Message, 100),
+	}
+	go func() {
+		defer close(sub.messages)
+		for msg := range pubsub.Channel() {
+			sub.messages <- &Message{Channel: msg.Channel, Payload: msg.Payload}
+		}
+	}()
+	return sub
+}
+
+func (s *redisSubscription) Channel() <-chan *Message {
+	return s.messages
+}
+
+func (s *redisSubscription) Close() error {
+	return s.pubsub.Close()
+}
+
+var acquireLeaseScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, leaseId in ipairs(expired) do
+	redis.call('HDEL', KEYS[2], leaseId)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local used = 0
+for _, weight in ipairs(redis.call('HVALS', KEYS[2])) do
+	used = used + tonumber(weight)
+end
+if used + tonumber(ARGV[4]) <= tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[5])
+	redis.call('HSET', KEYS[2], ARGV[5], ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[6])
+	redis.call('PEXPIRE', KEYS[2], ARGV[6])
+	return {1, used + tonumber(ARGV[4])}
+end
+return {0, used}
+`)
+
+func (sm *redisManager) AcquireLease(key string, leaseId string, cost int, limit int, ttl time.Duration) (bool, int, error) {
+	now := time.Now()
+	keys := []string{key, key + ":weights"}
+	result, err := acquireLeaseScript.Run(context.Background(), sm.redisStorage.client, keys,
+		now.UnixMilli(), now.Add(ttl).UnixMilli(), limit, cost, leaseId, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, int(result[1]), nil
+}
+
+func (sm *redisManager) ReleaseLease(key string, leaseId string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := sm.redisStorage.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(context.Background(), key, leaseId)
+		pipe.HDel(context.Background(), key+":weights", leaseId)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed.Val() > 0, nil
+}
+
+func (sm *redisManager) SetOverride(key string, name string, data []byte) error {
+	storageKey := overridesKey(key)
+	return sm.redisStorage.client.HSet(context.Background(), storageKey, name, data).Err()
+}
+
+func (sm *redisManager) GetOverrides(key string) (map[string]string, error) {
+	return sm.getHash(overridesKey(key))
+}
+
+func (sm *redisManager) DeleteOverride(key string, name string) (bool, error) {
+	storageKey := overridesKey(key)
+	removed, err := sm.redisStorage.client.HDel(context.Background(), storageKey, name).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+func (sm *redisManager) GetConfigureMap(key string) (map[string]string, error) {
+	data, err := sm.getHash(configureKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New(ErrDataNotFound)
+	}
+	return data, nil
+}
+
+func (sm *redisManager) SetConfigureField(key string, field string, value string) error {
+	storageKey := configureKey(key)
+	return sm.redisStorage.client.HSet(context.Background(), storageKey, field, value).Err()
+}
+
+func configureKey(key string) string {
+	return "configure:" + HashTag(key)
+}
+
+func overridesKey(key string) string {
+	return "overrides:" + HashTag(key)
+}
+
+func historyKey(key string) string {
+	return "configure-history:" + HashTag(key)
+}
+
+// ListConfigureKeys scans the configured keys starting with prefix, returning
+// a page of keys and the cursor of the next page (0 once done). A cluster
+// can't be scanned with a single cursor, so there the keys of every node are
+// sorted and the cursor is the position of the next page.
+func (sm *redisManager) ListConfigureKeys(prefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	if config.REDIS_MODE == REDIS_MODE_CLUSTER {
+		// Only the opening brace is matched, the prefix is followed by the
+		// rest of the key.
+		match := "configure:{" + escapePattern(prefix) + "*"
+		keys := []string{}
+		err := sm.redisStorage.scan(context.Background(), match, func(storageKey string) error {
+			keys = append(keys, configKeyOf(storageKey))
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		sort.Strings(keys)
+		if cursor >= uint64(len(keys)) {
+			return []string{}, 0, nil
+		}
+		end := cursor + uint64(count)
+		if end >= uint64(len(keys)) {
+			return keys[cursor:], 0, nil
+		}
+		return keys[cursor:end], end, nil
+	}
+	match := "configure:" + escapePattern(prefix) + "*"
+	storageKeys, nextCursor, err := sm.redisStorage.client.Scan(context.Background(), cursor, match, count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make([]string, 0, len(storageKeys))
+	for _, storageKey := range storageKeys {
+		keys = append(keys, configKeyOf(storageKey))
+	}
+	return keys, nextCursor, nil
+}
+
+// configKeyOf returns the key a "configure:" storage key was built from.
+func configKeyOf(storageKey string) string {
+	key := strings.TrimPrefix(storageKey, "configure:")
+	if config.REDIS_MODE == REDIS_MODE_CLUSTER {
+		key = strings.TrimSuffix(strings.TrimPrefix(key, "{"), "}")
+	}
+	return key
+}
+
+// The keys of different configurations may live on different cluster nodes,
+// so they are deleted one by one in a pipeline.
+func (sm *redisManager) DeleteConfigureData(keys ...string) error {
+	_, err := sm.redisStorage.client.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(context.Background(), configureKey(key), overridesKey(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	for _, key := range keys {
+		delete(sm.lastKnown, configureKey(key))
+		delete(sm.lastKnown, overridesKey(key))
+	}
+	return nil
+}
+
+func (sm *redisManager) DeleteLimiterData(limiterKey string) error {
+	escapedKey := escapePattern(limiterKey)
+	for _, match := range []string{escapedKey, escapedKey + ":*"} {
+		err := sm.redisStorage.scan(context.Background(), match, func(key string) error {
+			return sm.redisStorage.client.Del(context.Background(), key).Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapePattern escapes the glob characters of a key used in a SCAN match.
+func escapePattern(key string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(key)
+}
+
+func (sm *redisManager) AppendConfigureHistory(key string, data []byte) (int64, error) {
+	storageKey := historyKey(key)
+	return sm.redisStorage.client.RPush(context.Background(), storageKey, data).Result()
+}
+
+func (sm *redisManager) GetConfigureHistory(key string) ([]string, error) {
+	storageKey := historyKey(key)
+	return sm.redisStorage.client.LRange(context.Background(), storageKey, 0, -1).Result()
+}
+
+func (sm *redisManager) GetConfigureVersion(key string, version int64) (string, error) {
+	storageKey := historyKey(key)
+	data, err := sm.redisStorage.client.LIndex(context.Background(), storageKey, version-1).Result()
+	if err == redis.Nil {
+		return "", errors.New(ErrDataNotFound)
+	}
+	return data, err
+}
+
+// Both scripts read the clock of Redis so every instance agrees on it.
+var takeTokensScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refillRate = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'lastRefill')
+local tokens = tonumber(state[1]) or capacity
+local lastRefill = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(now - lastRefill, 0) / 1000000 * refillRate)
+local allowed = 0
+if tokens >= cost then
+	tokens = math.min(capacity, tokens - cost)
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'lastRefill', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / refillRate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+func (sm *redisManager) TakeTokens(key string, capacity float64, refillRate float64, cost int) (bool, float64, error) {
+	result, err := takeTokensScript.Run(context.Background(), sm.redisStorage.client, []string{key}, capacity, refillRate, cost).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	tokens, err := strconv.ParseFloat(result[1].(string), 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0].(int64) == 1, tokens, nil
+}
+
+var addToWindowScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local windowSize = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - windowSize)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count + cost <= capacity then
+	for i = 1, cost do
+		redis.call('ZADD', KEYS[1], now, ARGV[4] .. ':' .. i)
+	end
+	redis.call('PEXPIRE', KEYS[1], math.ceil(windowSize / 1000))
+	count = count + cost
+	allowed = 1
+end
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = windowSize - (now - tonumber(oldest[2]))
+end
+return {allowed, count, reset}
+`)
+
+func (sm *redisManager) AddToWindow(key string, capacity int, windowSize time.Duration, cost int, member string) (bool, int, time.Duration, error) {
+	result, err := addToWindowScript.Run(context.Background(), sm.redisStorage.client, []string{key},
+		capacity, windowSize.Microseconds(), cost, member).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return result[0] == 1, int(result[1]), time.Duration(result[2]) * time.Microsecond, nil
+}
+
+func (sm *redisManager) RemoveFromWindow(key string, members []string) error {
+	return sm.redisStorage.client.ZRem(context.Background(), key, members).Err()
+}
+
+// Sliding window logs are sorted sets scored by timestamp. Members start with
+// the timestamp in nanoseconds, which the score can't hold exactly.
+func (sm *redisManager) GetWindowLog(key string, since time.Time) ([]int64, error) {
+	members, err := sm.redisStorage.client.ZRangeByScore(context.Background(), key, &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", since.UnixNano()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	timestamps := make([]int64, 0, len(members))
+	for _, member := range members {
+		timestamp, _, _ := strings.Cut(member, ":")
+		if value, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+			timestamps = append(timestamps, value)
+		}
+	}
+	return timestamps, nil
+}
+
+func (sm *redisManager) AddToWindowLog(key string, members []string, cutoff time.Time, ttl time.Duration) error {
+	entries := make([]redis.Z, 0, len(members))
+	for _, member := range members {
+		entries = append(entries, redis.Z{
+			Score:  float64(WindowMemberTimestamp(member)),
+			Member: member,
+		})
+	}
+	_, err := sm.redisStorage.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(context.Background(), key, entries...)
+		pipe.ZRemRangeByScore(context.Background(), key, "-inf", fmt.Sprintf("%d", cutoff.UnixNano()))
+		pipe.PExpire(context.Background(), key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (sm *redisManager) MigrateWindowLog(legacyKey string, key string) error {
+	exists, err := sm.redisStorage.client.Exists(context.Background(), key).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	data, err := sm.redisStorage.client.HGet(context.Background(), legacyKey, "requestLog").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var timestamps []int64
+	if err := json.Unmarshal([]byte(data), &timestamps); err != nil || len(timestamps) == 0 {
+		return nil
+	}
+	ttl, err := sm.redisStorage.client.PTTL(context.Background(), legacyKey).Result()
+	if err != nil {
+		return err
+	}
+	// Members only depend on the entry so instances migrating at the same
+	// time add the same ones.
+	members := make([]redis.Z, 0, len(timestamps))
+	for i, timestamp := range timestamps {
+		members = append(members, redis.Z{
+			Score:  float64(timestamp),
+			Member: fmt.Sprintf("%d:legacy-%d", timestamp, i),
+		})
+	}
+	_, err = sm.redisStorage.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(context.Background(), key, members...)
+		if ttl > 0 {
+			pipe.PExpire(context.Background(), key, ttl)
+		}
+		return nil
+	})
+	return err
+}
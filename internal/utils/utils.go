@@ -40,7 +40,7 @@ func StructToMap(data any) map[string]any {
 
 		value := v.Field(i)
 		if (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) &&
-			value.Type().Elem().Kind() == reflect.Int64 {
+			value.Type().Elem().Kind() == reflect.Int64 || value.Kind() == reflect.Map {
 			b, _ := json.Marshal(value.Interface())
 			m[tag] = b
 		} else {
@@ -85,9 +85,9 @@ func MapToStruct(m map[string]string, out any) error {
 					continue
 				}
 
-				// Handle slices/arrays of structs from JSON
+				// Handle slices/arrays and maps from JSON
 				if (v.Field(i).Kind() == reflect.Slice || v.Field(i).Kind() == reflect.Array) &&
-					v.Field(i).Type().Elem().Kind() == reflect.Int64 {
+					v.Field(i).Type().Elem().Kind() == reflect.Int64 || v.Field(i).Kind() == reflect.Map {
 					slicePtr := reflect.New(v.Field(i).Type()).Interface()
 					if err := json.Unmarshal([]byte(val), slicePtr); err == nil {
 						v.Field(i).Set(reflect.ValueOf(slicePtr).Elem())
@@ -0,0 +1,4 @@
+// Package ratelimiterpb holds the gRPC API of the rate limiting service.
+package ratelimiterpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ratelimiter.proto
@@ -0,0 +1,902 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: ratelimiter.proto
+
+package ratelimiterpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CheckRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Args  []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
+	// Units consumed by the request, 1 when unset.
+	Cost          int32 `protobuf:"varint,3,opt,name=cost,proto3" json:"cost,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckRequest) Reset() {
+	*x = CheckRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckRequest) ProtoMessage() {}
+
+func (x *CheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckRequest.ProtoReflect.Descriptor instead.
+func (*CheckRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CheckRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetCost() int32 {
+	if x != nil {
+		return x.Cost
+	}
+	return 0
+}
+
+type CheckResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Allowed bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	// The X-RateLimit-* and Retry-After headers /check answers with.
+	Headers map[string]string `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Delay assigned by a leaky bucket before the request may proceed.
+	DelayMs int64 `protobuf:"varint,3,opt,name=delay_ms,json=delayMs,proto3" json:"delay_ms,omitempty"`
+	// Slot acquired from a concurrency limiter, to pass to Release.
+	LeaseId       string `protobuf:"bytes,4,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckResponse) Reset() {
+	*x = CheckResponse{}
+	mi := &file_ratelimiter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckResponse) ProtoMessage() {}
+
+func (x *CheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckResponse.ProtoReflect.Descriptor instead.
+func (*CheckResponse) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *CheckResponse) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *CheckResponse) GetDelayMs() int64 {
+	if x != nil {
+		return x.DelayMs
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+type CheckBatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Items []*CheckRequest        `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// "independent", the default, or "all-or-nothing" to give back the units
+	// taken by the other items once one is denied.
+	Mode          string `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckBatchRequest) Reset() {
+	*x = CheckBatchRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckBatchRequest) ProtoMessage() {}
+
+func (x *CheckBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckBatchRequest.ProtoReflect.Descriptor instead.
+func (*CheckBatchRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CheckBatchRequest) GetItems() []*CheckRequest {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *CheckBatchRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+type CheckBatchResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Results []*CheckBatchResult    `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	// Set when every item is allowed.
+	Allowed       bool `protobuf:"varint,2,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckBatchResponse) Reset() {
+	*x = CheckBatchResponse{}
+	mi := &file_ratelimiter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckBatchResponse) ProtoMessage() {}
+
+func (x *CheckBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckBatchResponse.ProtoReflect.Descriptor instead.
+func (*CheckBatchResponse) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CheckBatchResponse) GetResults() []*CheckBatchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *CheckBatchResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+type CheckBatchResult struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Allowed bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	Headers map[string]string      `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Why the item couldn't be checked, e.g. "rate limiter not found".
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckBatchResult) Reset() {
+	*x = CheckBatchResult{}
+	mi := &file_ratelimiter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckBatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckBatchResult) ProtoMessage() {}
+
+func (x *CheckBatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckBatchResult.ProtoReflect.Descriptor instead.
+func (*CheckBatchResult) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckBatchResult) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *CheckBatchResult) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *CheckBatchResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Args          []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseRequest) Reset() {
+	*x = ReleaseRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseRequest) ProtoMessage() {}
+
+func (x *ReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ReleaseRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ReleaseRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *ReleaseRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+type ReleaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseResponse) Reset() {
+	*x = ReleaseResponse{}
+	mi := &file_ratelimiter_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseResponse) ProtoMessage() {}
+
+func (x *ReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{6}
+}
+
+type ConfigureRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Key         string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	LimiterType int32                  `protobuf:"varint,2,opt,name=limiter_type,json=limiterType,proto3" json:"limiter_type,omitempty"`
+	// The limiter configuration as a JSON object, as sent to /configure.
+	Configuration string `protobuf:"bytes,3,opt,name=configuration,proto3" json:"configuration,omitempty"`
+	// "eventual" (default) or "strict".
+	Consistency string `protobuf:"bytes,4,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	// Recorded in the configuration history.
+	Author        string `protobuf:"bytes,5,opt,name=author,proto3" json:"author,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigureRequest) Reset() {
+	*x = ConfigureRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigureRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigureRequest) ProtoMessage() {}
+
+func (x *ConfigureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigureRequest.ProtoReflect.Descriptor instead.
+func (*ConfigureRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ConfigureRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ConfigureRequest) GetLimiterType() int32 {
+	if x != nil {
+		return x.LimiterType
+	}
+	return 0
+}
+
+func (x *ConfigureRequest) GetConfiguration() string {
+	if x != nil {
+		return x.Configuration
+	}
+	return ""
+}
+
+func (x *ConfigureRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+func (x *ConfigureRequest) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+type ConfigureResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigureResponse) Reset() {
+	*x = ConfigureResponse{}
+	mi := &file_ratelimiter_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigureResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigureResponse) ProtoMessage() {}
+
+func (x *ConfigureResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigureResponse.ProtoReflect.Descriptor instead.
+func (*ConfigureResponse) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{8}
+}
+
+type GetMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsRequest) Reset() {
+	*x = GetMetricsRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsRequest) ProtoMessage() {}
+
+func (x *GetMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{9}
+}
+
+type Metrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TotalRequests int64                  `protobuf:"varint,1,opt,name=total_requests,json=totalRequests,proto3" json:"total_requests,omitempty"`
+	Allowed       int64                  `protobuf:"varint,2,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	Blocked       int64                  `protobuf:"varint,3,opt,name=blocked,proto3" json:"blocked,omitempty"`
+	AvgLatencyMs  float64                `protobuf:"fixed64,4,opt,name=avg_latency_ms,json=avgLatencyMs,proto3" json:"avg_latency_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metrics) Reset() {
+	*x = Metrics{}
+	mi := &file_ratelimiter_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metrics) ProtoMessage() {}
+
+func (x *Metrics) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metrics.ProtoReflect.Descriptor instead.
+func (*Metrics) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Metrics) GetTotalRequests() int64 {
+	if x != nil {
+		return x.TotalRequests
+	}
+	return 0
+}
+
+func (x *Metrics) GetAllowed() int64 {
+	if x != nil {
+		return x.Allowed
+	}
+	return 0
+}
+
+func (x *Metrics) GetBlocked() int64 {
+	if x != nil {
+		return x.Blocked
+	}
+	return 0
+}
+
+func (x *Metrics) GetAvgLatencyMs() float64 {
+	if x != nil {
+		return x.AvgLatencyMs
+	}
+	return 0
+}
+
+type WatchLimitsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	KeyPrefix     string                 `protobuf:"bytes,1,opt,name=key_prefix,json=keyPrefix,proto3" json:"key_prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchLimitsRequest) Reset() {
+	*x = WatchLimitsRequest{}
+	mi := &file_ratelimiter_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchLimitsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchLimitsRequest) ProtoMessage() {}
+
+func (x *WatchLimitsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchLimitsRequest.ProtoReflect.Descriptor instead.
+func (*WatchLimitsRequest) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *WatchLimitsRequest) GetKeyPrefix() string {
+	if x != nil {
+		return x.KeyPrefix
+	}
+	return ""
+}
+
+type LimitUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Deleted       bool                   `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	LimiterType   int32                  `protobuf:"varint,3,opt,name=limiter_type,json=limiterType,proto3" json:"limiter_type,omitempty"`
+	Configuration string                 `protobuf:"bytes,4,opt,name=configuration,proto3" json:"configuration,omitempty"`
+	Consistency   string                 `protobuf:"bytes,5,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LimitUpdate) Reset() {
+	*x = LimitUpdate{}
+	mi := &file_ratelimiter_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LimitUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LimitUpdate) ProtoMessage() {}
+
+func (x *LimitUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_ratelimiter_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LimitUpdate.ProtoReflect.Descriptor instead.
+func (*LimitUpdate) Descriptor() ([]byte, []int) {
+	return file_ratelimiter_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *LimitUpdate) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *LimitUpdate) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *LimitUpdate) GetLimiterType() int32 {
+	if x != nil {
+		return x.LimiterType
+	}
+	return 0
+}
+
+func (x *LimitUpdate) GetConfiguration() string {
+	if x != nil {
+		return x.Configuration
+	}
+	return ""
+}
+
+func (x *LimitUpdate) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+var File_ratelimiter_proto protoreflect.FileDescriptor
+
+const file_ratelimiter_proto_rawDesc = "" +
+	"\n" +
+	"\x11ratelimiter.proto\x12\x0eratelimiter.v1\"H\n" +
+	"\fCheckRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\x12\x12\n" +
+	"\x04cost\x18\x03 \x01(\x05R\x04cost\"\xe1\x01\n" +
+	"\rCheckResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12D\n" +
+	"\aheaders\x18\x02 \x03(\v2*.ratelimiter.v1.CheckResponse.HeadersEntryR\aheaders\x12\x19\n" +
+	"\bdelay_ms\x18\x03 \x01(\x03R\adelayMs\x12\x19\n" +
+	"\blease_id\x18\x04 \x01(\tR\aleaseId\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"[\n" +
+	"\x11CheckBatchRequest\x122\n" +
+	"\x05items\x18\x01 \x03(\v2\x1c.ratelimiter.v1.CheckRequestR\x05items\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\"j\n" +
+	"\x12CheckBatchResponse\x12:\n" +
+	"\aresults\x18\x01 \x03(\v2 .ratelimiter.v1.CheckBatchResultR\aresults\x12\x18\n" +
+	"\aallowed\x18\x02 \x01(\bR\aallowed\"\xc7\x01\n" +
+	"\x10CheckBatchResult\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12G\n" +
+	"\aheaders\x18\x02 \x03(\v2-.ratelimiter.v1.CheckBatchResult.HeadersEntryR\aheaders\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"Q\n" +
+	"\x0eReleaseRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\x12\x19\n" +
+	"\blease_id\x18\x03 \x01(\tR\aleaseId\"\x11\n" +
+	"\x0fReleaseResponse\"\xa7\x01\n" +
+	"\x10ConfigureRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12!\n" +
+	"\flimiter_type\x18\x02 \x01(\x05R\vlimiterType\x12$\n" +
+	"\rconfiguration\x18\x03 \x01(\tR\rconfiguration\x12 \n" +
+	"\vconsistency\x18\x04 \x01(\tR\vconsistency\x12\x16\n" +
+	"\x06author\x18\x05 \x01(\tR\x06author\"\x13\n" +
+	"\x11ConfigureResponse\"\x13\n" +
+	"\x11GetMetricsRequest\"\x8a\x01\n" +
+	"\aMetrics\x12%\n" +
+	"\x0etotal_requests\x18\x01 \x01(\x03R\rtotalRequests\x12\x18\n" +
+	"\aallowed\x18\x02 \x01(\x03R\aallowed\x12\x18\n" +
+	"\ablocked\x18\x03 \x01(\x03R\ablocked\x12$\n" +
+	"\x0eavg_latency_ms\x18\x04 \x01(\x01R\favgLatencyMs\"3\n" +
+	"\x12WatchLimitsRequest\x12\x1d\n" +
+	"\n" +
+	"key_prefix\x18\x01 \x01(\tR\tkeyPrefix\"\xa4\x01\n" +
+	"\vLimitUpdate\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\x12!\n" +
+	"\flimiter_type\x18\x03 \x01(\x05R\vlimiterType\x12$\n" +
+	"\rconfiguration\x18\x04 \x01(\tR\rconfiguration\x12 \n" +
+	"\vconsistency\x18\x05 \x01(\tR\vconsistency2\xe2\x03\n" +
+	"\vRateLimiter\x12D\n" +
+	"\x05Check\x12\x1c.ratelimiter.v1.CheckRequest\x1a\x1d.ratelimiter.v1.CheckResponse\x12S\n" +
+	"\n" +
+	"CheckBatch\x12!.ratelimiter.v1.CheckBatchRequest\x1a\".ratelimiter.v1.CheckBatchResponse\x12J\n" +
+	"\aRelease\x12\x1e.ratelimiter.v1.ReleaseRequest\x1a\x1f.ratelimiter.v1.ReleaseResponse\x12P\n" +
+	"\tConfigure\x12 .ratelimiter.v1.ConfigureRequest\x1a!.ratelimiter.v1.ConfigureResponse\x12H\n" +
+	"\n" +
+	"GetMetrics\x12!.ratelimiter.v1.GetMetricsRequest\x1a\x17.ratelimiter.v1.Metrics\x12P\n" +
+	"\vWatchLimits\x12\".ratelimiter.v1.WatchLimitsRequest\x1a\x1b.ratelimiter.v1.LimitUpdate0\x01B)Z'rate-limiting-service/pkg/ratelimiterpbb\x06proto3"
+
+var (
+	file_ratelimiter_proto_rawDescOnce sync.Once
+	file_ratelimiter_proto_rawDescData []byte
+)
+
+func file_ratelimiter_proto_rawDescGZIP() []byte {
+	file_ratelimiter_proto_rawDescOnce.Do(func() {
+		file_ratelimiter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ratelimiter_proto_rawDesc), len(file_ratelimiter_proto_rawDesc)))
+	})
+	return file_ratelimiter_proto_rawDescData
+}
+
+var file_ratelimiter_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_ratelimiter_proto_goTypes = []any{
+	(*CheckRequest)(nil),       // 0: ratelimiter.v1.CheckRequest
+	(*CheckResponse)(nil),      // 1: ratelimiter.v1.CheckResponse
+	(*CheckBatchRequest)(nil),  // 2: ratelimiter.v1.CheckBatchRequest
+	(*CheckBatchResponse)(nil), // 3: ratelimiter.v1.CheckBatchResponse
+	(*CheckBatchResult)(nil),   // 4: ratelimiter.v1.CheckBatchResult
+	(*ReleaseRequest)(nil),     // 5: ratelimiter.v1.ReleaseRequest
+	(*ReleaseResponse)(nil),    // 6: ratelimiter.v1.ReleaseResponse
+	(*ConfigureRequest)(nil),   // 7: ratelimiter.v1.ConfigureRequest
+	(*ConfigureResponse)(nil),  // 8: ratelimiter.v1.ConfigureResponse
+	(*GetMetricsRequest)(nil),  // 9: ratelimiter.v1.GetMetricsRequest
+	(*Metrics)(nil),            // 10: ratelimiter.v1.Metrics
+	(*WatchLimitsRequest)(nil), // 11: ratelimiter.v1.WatchLimitsRequest
+	(*LimitUpdate)(nil),        // 12: ratelimiter.v1.LimitUpdate
+	nil,                        // 13: ratelimiter.v1.CheckResponse.HeadersEntry
+	nil,                        // 14: ratelimiter.v1.CheckBatchResult.HeadersEntry
+}
+var file_ratelimiter_proto_depIdxs = []int32{
+	13, // 0: ratelimiter.v1.CheckResponse.headers:type_name -> ratelimiter.v1.CheckResponse.HeadersEntry
+	0,  // 1: ratelimiter.v1.CheckBatchRequest.items:type_name -> ratelimiter.v1.CheckRequest
+	4,  // 2: ratelimiter.v1.CheckBatchResponse.results:type_name -> ratelimiter.v1.CheckBatchResult
+	14, // 3: ratelimiter.v1.CheckBatchResult.headers:type_name -> ratelimiter.v1.CheckBatchResult.HeadersEntry
+	0,  // 4: ratelimiter.v1.RateLimiter.Check:input_type -> ratelimiter.v1.CheckRequest
+	2,  // 5: ratelimiter.v1.RateLimiter.CheckBatch:input_type -> ratelimiter.v1.CheckBatchRequest
+	5,  // 6: ratelimiter.v1.RateLimiter.Release:input_type -> ratelimiter.v1.ReleaseRequest
+	7,  // 7: ratelimiter.v1.RateLimiter.Configure:input_type -> ratelimiter.v1.ConfigureRequest
+	9,  // 8: ratelimiter.v1.RateLimiter.GetMetrics:input_type -> ratelimiter.v1.GetMetricsRequest
+	11, // 9: ratelimiter.v1.RateLimiter.WatchLimits:input_type -> ratelimiter.v1.WatchLimitsRequest
+	1,  // 10: ratelimiter.v1.RateLimiter.Check:output_type -> ratelimiter.v1.CheckResponse
+	3,  // 11: ratelimiter.v1.RateLimiter.CheckBatch:output_type -> ratelimiter.v1.CheckBatchResponse
+	6,  // 12: ratelimiter.v1.RateLimiter.Release:output_type -> ratelimiter.v1.ReleaseResponse
+	8,  // 13: ratelimiter.v1.RateLimiter.Configure:output_type -> ratelimiter.v1.ConfigureResponse
+	10, // 14: ratelimiter.v1.RateLimiter.GetMetrics:output_type -> ratelimiter.v1.Metrics
+	12, // 15: ratelimiter.v1.RateLimiter.WatchLimits:output_type -> ratelimiter.v1.LimitUpdate
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_ratelimiter_proto_init() }
+func file_ratelimiter_proto_init() {
+	if File_ratelimiter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ratelimiter_proto_rawDesc), len(file_ratelimiter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ratelimiter_proto_goTypes,
+		DependencyIndexes: file_ratelimiter_proto_depIdxs,
+		MessageInfos:      file_ratelimiter_proto_msgTypes,
+	}.Build()
+	File_ratelimiter_proto = out.File
+	file_ratelimiter_proto_goTypes = nil
+	file_ratelimiter_proto_depIdxs = nil
+}
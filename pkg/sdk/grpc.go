@@ -0,0 +1,93 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	"rate-limiting-service/pkg/ratelimiterpb"
+
+	"github.com/gofiber/fiber/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DialGRPC opens a connection to the Rate Limiter gRPC API, e.g. localhost:3124.
+func DialGRPC(target string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// GRPCMiddleware returns a Fiber middleware that checks with the RL gRPC API
+// before proceeding. It behaves like Middleware; CheckURL, ReleaseURL and
+// HTTPClient are ignored.
+func GRPCMiddleware(cfg Config, conn grpc.ClientConnInterface) fiber.Handler {
+	if cfg.ArgsExtractor == nil {
+		cfg.ArgsExtractor = DefaultArgsExtractor()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	client := ratelimiterpb.NewRateLimiterClient(conn)
+
+	return func(c fiber.Ctx) error {
+		key := cfg.Key
+		args, err := cfg.ArgsExtractor(c)
+		if err != nil || key == "" {
+			if cfg.FailOpen {
+				return c.Next()
+			}
+			return c.Status(fiber.StatusBadRequest).SendString("rate limit: missing key")
+		}
+
+		request := &ratelimiterpb.CheckRequest{Key: key, Args: args}
+		if cfg.CostExtractor != nil {
+			cost, err := cfg.CostExtractor(c)
+			if err != nil {
+				if cfg.FailOpen {
+					return c.Next()
+				}
+				return c.Status(fiber.StatusBadRequest).SendString("rate limit: invalid cost")
+			}
+			request.Cost = int32(cost)
+		}
+
+		ctx, cancel := context.WithTimeout(c.RequestCtx(), cfg.Timeout)
+		defer cancel()
+
+		response, err := client.Check(ctx, request)
+		if err != nil {
+			// Timeout / network / RL error — choose fail-open vs fail-closed
+			if cfg.FailOpen {
+				return c.Next()
+			}
+			return c.Status(fiber.StatusServiceUnavailable).SendString("rate limit: unavailable")
+		}
+
+		// Forward X-RateLimit-* headers to client if provided
+		for _, header := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+			if v := response.Headers[header]; v != "" {
+				c.Set(header, v)
+			}
+		}
+
+		if !response.Allowed {
+			return c.Status(fiber.StatusTooManyRequests).SendString("Too Many Requests")
+		}
+		if cfg.WaitForDelay && response.DelayMs > 0 {
+			time.Sleep(time.Duration(response.DelayMs) * time.Millisecond)
+		}
+		if response.LeaseId != "" {
+			defer releaseGRPCLease(client, cfg.Timeout, key, args, response.LeaseId)
+		}
+		return c.Next()
+	}
+}
+
+// releaseGRPCLease frees a concurrency slot in the background. Failures are
+// ignored since the limiter reclaims leases once their TTL passes.
+func releaseGRPCLease(client ratelimiterpb.RateLimiterClient, timeout time.Duration, key string, args []string, leaseId string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, _ = client.Release(ctx, &ratelimiterpb.ReleaseRequest{Key: key, Args: args, LeaseId: leaseId})
+	}()
+}
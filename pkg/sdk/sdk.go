@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -14,6 +16,8 @@ import (
 
 type ExtractFunc func(c fiber.Ctx) (args []string, err error)
 
+type CostExtractFunc func(c fiber.Ctx) (cost int, err error)
+
 type Config struct {
 	// URL to Rate Limiter /check, e.g. http://localhost:3123/check
 	CheckURL string
@@ -22,6 +26,10 @@ type Config struct {
 	// key: who to limit (userId/api-key/ip/tenant)
 	ArgsExtractor ExtractFunc
 
+	// Optional: extract how many units the incoming request consumes
+	// (bytes uploaded, tokens, rows...). Requests cost 1 unit when unset.
+	CostExtractor CostExtractFunc
+
 	// How long to wait for /check
 	Timeout time.Duration
 
@@ -33,6 +41,14 @@ type Config struct {
 
 	// Optional: custom http.Client (reused across requests)
 	HTTPClient *http.Client
+
+	// Optional: URL to Rate Limiter /release, e.g. http://localhost:3123/release
+	// Defaults to CheckURL with /check replaced by /release
+	ReleaseURL string
+
+	// WaitForDelay=true -> sleep for the X-RateLimit-Delay assigned by a
+	// leaky bucket limiter before calling the next handler
+	WaitForDelay bool
 }
 
 func DefaultArgsExtractor() ExtractFunc {
@@ -76,6 +92,13 @@ func Middleware(cfg Config) fiber.Handler {
 	if err != nil {
 		panic(fmt.Errorf("rlsdk: invalid CheckURL: %w", err))
 	}
+	if cfg.ReleaseURL == "" {
+		cfg.ReleaseURL = strings.TrimSuffix(cfg.CheckURL, "/check") + "/release"
+	}
+	releaseURL, err := url.Parse(cfg.ReleaseURL)
+	if err != nil {
+		panic(fmt.Errorf("rlsdk: invalid ReleaseURL: %w", err))
+	}
 
 	return func(c fiber.Ctx) error {
 		key := cfg.Key
@@ -88,12 +111,22 @@ func Middleware(cfg Config) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).SendString("rate limit: missing key")
 		}
 
-		// Build /check?key=...&args[0]=..&args[1]=...
+		// Build /check?key=...&args[0]=..&args[1]=...&cost=...
 		q := checkURL.Query()
 		q.Set("key", key)
 		for _, arg := range args {
 			q.Add("args", arg)
 		}
+		if cfg.CostExtractor != nil {
+			cost, err := cfg.CostExtractor(c)
+			if err != nil {
+				if cfg.FailOpen {
+					return c.Next()
+				}
+				return c.Status(fiber.StatusBadRequest).SendString("rate limit: invalid cost")
+			}
+			q.Set("cost", strconv.Itoa(cost))
+		}
 
 		u := *checkURL
 		u.RawQuery = q.Encode()
@@ -131,11 +164,23 @@ func Middleware(cfg Config) fiber.Handler {
 		if v := resp.Header.Get("X-RateLimit-Reset"); v != "" {
 			c.Set("X-RateLimit-Reset", v)
 		}
+		if v := resp.Header.Get("Retry-After"); v != "" {
+			c.Set("Retry-After", v)
+		}
 
 		// Allow / Deny
 		switch resp.StatusCode {
 		case http.StatusOK, http.StatusNoContent:
-			// Allowed
+			// Allowed, possibly after waiting in the limiter's queue
+			if cfg.WaitForDelay {
+				if delayMs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Delay"), 10, 64); err == nil && delayMs > 0 {
+					time.Sleep(time.Duration(delayMs) * time.Millisecond)
+				}
+			}
+			// Concurrency limiters hand out a slot that is freed once we are done
+			if leaseId := resp.Header.Get("X-RateLimit-Lease"); leaseId != "" {
+				defer releaseLease(cfg.HTTPClient, releaseURL, key, args, leaseId)
+			}
 			return c.Next()
 		case http.StatusTooManyRequests:
 			// Denied
@@ -149,3 +194,26 @@ func Middleware(cfg Config) fiber.Handler {
 		}
 	}
 }
+
+// releaseLease frees a concurrency slot in the background. Failures are
+// ignored since the limiter reclaims leases once their TTL passes.
+func releaseLease(client *http.Client, releaseURL *url.URL, key string, args []string, leaseId string) {
+	q := releaseURL.Query()
+	q.Set("key", key)
+	for _, arg := range args {
+		q.Add("args", arg)
+	}
+	q.Set("leaseId", leaseId)
+
+	u := *releaseURL
+	u.RawQuery = q.Encode()
+
+	go func() {
+		resp, err := client.Post(u.String(), "", nil)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}()
+}
@@ -1,11 +1,45 @@
 package limiter
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rate-limiting-service/internal/config"
 	"rate-limiting-service/internal/limiter"
+	"rate-limiting-service/internal/logger"
+	"rate-limiting-service/internal/rpc"
+	"rate-limiting-service/internal/services"
+	"rate-limiting-service/internal/storage"
+	"rate-limiting-service/pkg/ratelimiterpb"
+	"rate-limiting-service/pkg/sdk"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/gofiber/fiber/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// TestMain runs the suite on the memory backend, so it needs no Redis, unless
+// STORAGE_BACKEND picks another.
+func TestMain(m *testing.M) {
+	if os.Getenv("STORAGE_BACKEND") == "" {
+		config.STORAGE_BACKEND = storage.STORAGE_BACKEND_MEMORY
+	}
+	os.Exit(m.Run())
+}
+
 func TestTokenBucketLimiter(t *testing.T) {
 	// Create limiter with capacity 5, refill rate 1 token/sec
 	tb := &limiter.TokenBucketLimiter{
@@ -17,13 +51,13 @@ func TestTokenBucketLimiter(t *testing.T) {
 
 	// 1. Should allow first 5 requests immediately
 	for i := range 5 {
-		if allowed, _ := tb.Check(); !allowed {
+		if allowed, _, _ := tb.Check(1); !allowed {
 			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
 		}
 	}
 
 	// 2. Next request should be denied (empty bucket)
-	if allowed, _ := tb.Check(); allowed {
+	if allowed, _, _ := tb.Check(1); allowed {
 		t.Errorf("Expected request to be denied when bucket is empty")
 	}
 
@@ -31,7 +65,7 @@ func TestTokenBucketLimiter(t *testing.T) {
 	time.Sleep(2500 * time.Millisecond)
 	allowedCount := 0
 	for range 3 {
-		if allowed, _ := tb.Check(); allowed {
+		if allowed, _, _ := tb.Check(1); allowed {
 			allowedCount++
 		}
 	}
@@ -51,19 +85,1487 @@ func TestSlidingWindowLimiter(t *testing.T) {
 
 	// 1. Should allow first 3 requests immediately
 	for i := range 3 {
-		if allowed, _ := sw.Check(); !allowed {
+		if allowed, _, _ := sw.Check(1); !allowed {
 			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
 		}
 	}
 
 	// 2. Fourth request should be denied
-	if allowed, _ := sw.Check(); allowed {
+	if allowed, _, _ := sw.Check(1); allowed {
 		t.Errorf("Expected request to be denied when limit is reached")
 	}
 
 	// 3. Wait for 2.1 seconds (window expires) and check again
 	time.Sleep(2100 * time.Millisecond)
-	if allowed, _ := sw.Check(); !allowed {
+	if allowed, _, _ := sw.Check(1); !allowed {
 		t.Errorf("Expected request to be allowed after window expired")
 	}
 }
+
+func TestFixedWindowLimiter(t *testing.T) {
+	fw := &limiter.FixedWindowLimiter{
+		WindowSize: 2 * time.Second, // 2-second window
+		Capacity:   3,               // allow max 3 requests per window
+		Alignment:  limiter.ALIGNMENT_FIRST_REQUEST,
+	}
+
+	// 1. Should allow first 3 requests immediately
+	for i := range 3 {
+		if allowed, _, _ := fw.Check(1); !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+	}
+
+	// 2. Fourth request should be denied
+	if allowed, _, _ := fw.Check(1); allowed {
+		t.Errorf("Expected request to be denied when limit is reached")
+	}
+
+	// 3. Wait for the window to end, counter should reset
+	time.Sleep(2100 * time.Millisecond)
+	if allowed, _, _ := fw.Check(1); !allowed {
+		t.Errorf("Expected request to be allowed in the next window")
+	}
+}
+
+func TestFixedWindowPeerCounts(t *testing.T) {
+	key := fmt.Sprintf("fwpeers-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 10, "windowSize": 3600}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// A peer already counted 4 requests in the stored window
+	now := time.Now()
+	windowStart := time.Unix(0, now.UnixNano()-now.UnixNano()%int64(time.Hour))
+	storage.GetManager().SetLimiterData(limiter.GetLimiterKey(limiter.FIXED_WINDOW, key, []string{"user"}), &limiter.FixedWindowLimiter{
+		Capacity:    10,
+		WindowSize:  time.Hour,
+		Alignment:   limiter.ALIGNMENT_EPOCH,
+		WindowStart: windowStart,
+		Count:       4,
+		Instances:   map[string]int64{"peer": 4},
+		LastUpdated: now,
+	}, 60)
+
+	_, headers, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if headers["X-RateLimit-Remaining"] != "5" {
+		t.Errorf("Expected the stored count to be loaded, got %v", headers)
+	}
+
+	// The peer's next update is cumulative, only its new request is added
+	time.Sleep(100 * time.Millisecond)
+	update, _ := json.Marshal(map[string]any{
+		"windowStart": windowStart.UnixNano(),
+		"count":       5,
+		"lastUpdated": time.Now().UnixNano(),
+		"instanceId":  "peer",
+	})
+	storage.GetManager().PublishUpdates(limiter.GetUpdatesKey(limiter.FIXED_WINDOW, key, []string{"user"}), update)
+	time.Sleep(100 * time.Millisecond)
+
+	_, headers, _ = services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if headers["X-RateLimit-Remaining"] != "3" {
+		t.Errorf("Expected the peer's requests to be counted once, got %v", headers)
+	}
+
+	// The peer gives 2 back, then an older update arrives late and is ignored
+	updatesKey := limiter.GetUpdatesKey(limiter.FIXED_WINDOW, key, []string{"user"})
+	for _, counts := range [][2]int{{5, 2}, {5, 0}} {
+		update, _ = json.Marshal(map[string]any{
+			"windowStart": windowStart.UnixNano(),
+			"count":       counts[0],
+			"refunded":    counts[1],
+			"lastUpdated": time.Now().UnixNano(),
+			"instanceId":  "peer",
+		})
+		storage.GetManager().PublishUpdates(updatesKey, update)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	_, headers, _ = services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if headers["X-RateLimit-Remaining"] != "4" {
+		t.Errorf("Expected the peer's refund to be applied once, got %v", headers)
+	}
+}
+
+func TestSlidingWindowCounterLimiter(t *testing.T) {
+	swc := &limiter.SlidingWindowCounterLimiter{
+		WindowSize: 2 * time.Second, // 2-second windows
+		Capacity:   3,               // allow max ~3 requests per sliding window
+	}
+
+	// 1. Should allow first 3 requests immediately
+	for i := range 3 {
+		if allowed, _, _ := swc.Check(1); !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+	}
+
+	// 2. Fourth request should be denied
+	if allowed, _, _ := swc.Check(1); allowed {
+		t.Errorf("Expected request to be denied when limit is reached")
+	}
+
+	// 3. Wait until the previous window no longer overlaps and check again
+	time.Sleep(4100 * time.Millisecond)
+	if allowed, _, _ := swc.Check(1); !allowed {
+		t.Errorf("Expected request to be allowed after the window slid past")
+	}
+}
+
+func TestGCRALimiter(t *testing.T) {
+	// 1 request per second with a burst of 3
+	g := &limiter.GCRALimiter{
+		Rate:   1,
+		Period: time.Second,
+		Burst:  3,
+	}
+
+	// 1. Should allow the full burst immediately
+	for i := range 3 {
+		if allowed, _, _ := g.Check(1); !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+	}
+
+	// 2. Next request should be denied with a retry hint
+	allowed, headers, _ := g.Check(1)
+	if allowed {
+		t.Errorf("Expected request to be denied when burst is exhausted")
+	}
+	if headers["Retry-After"] != "1" {
+		t.Errorf("Expected Retry-After of 1 second, got %q", headers["Retry-After"])
+	}
+
+	// 3. Wait for one emission interval, exactly one request should pass
+	time.Sleep(1100 * time.Millisecond)
+	allowedCount := 0
+	for range 2 {
+		if allowed, _, _ := g.Check(1); allowed {
+			allowedCount++
+		}
+	}
+	if allowedCount != 1 {
+		t.Errorf("Expected 1 request allowed after one interval, got %d", allowedCount)
+	}
+}
+
+func TestRefundUpdates(t *testing.T) {
+	prefix := fmt.Sprintf("refunds-%d", time.Now().UnixNano())
+	configurations := map[string]struct {
+		limiterType   limiter.LimiterType
+		configuration string
+	}{
+		"gcra":   {limiter.GCRA, `{"rate": 1, "period": 3600, "burst": 5}`},
+		"leaky":  {limiter.LEAKY_BUCKET, `{"leakRate": 0.001, "queueDepth": 5}`},
+		"tenant": {limiter.TOKEN_BUCKET, `{"capacity": 1, "refillRate": 0.001}`},
+	}
+	for name, c := range configurations {
+		err := services.Configure(&services.ConfigureDTO{Key: prefix + name, LimiterType: c.limiterType, Configuration: json.RawMessage(c.configuration)})
+		if err != nil {
+			t.Fatalf("Expected %s to be configured, got %v", name, err)
+		}
+	}
+	args := []string{"a"}
+	services.Check(&services.CheckDTO{Key: prefix + "tenant", Args: args})
+
+	// 1. Units given back by a denied batch are published to the peers
+	gcraSub := storage.GetManager().SubscribeUpdates(limiter.GetUpdatesKey(limiter.GCRA, prefix+"gcra", args))
+	defer gcraSub.Close()
+	leakySub := storage.GetManager().SubscribeUpdates(limiter.GetUpdatesKey(limiter.LEAKY_BUCKET, prefix+"leaky", args))
+	defer leakySub.Close()
+	services.CheckBatch(&services.CheckBatchDTO{
+		Items: []services.CheckDTO{{Key: prefix + "gcra", Args: args}, {Key: prefix + "leaky", Args: args}, {Key: prefix + "tenant", Args: args}},
+		Mode:  services.CHECK_BATCH_ALL_OR_NOTHING,
+	})
+	for name, c := range map[string]struct {
+		sub      storage.Subscription
+		interval time.Duration
+	}{"gcra": {gcraSub, time.Hour}, "leaky": {leakySub, 1000 * time.Second}} {
+		refunded := false
+		for !refunded {
+			select {
+			case msg := <-c.sub.Channel():
+				var update map[string]any
+				json.Unmarshal([]byte(msg.Payload), &update)
+				refunded = update["refunded"] == float64(c.interval)
+			case <-time.After(time.Second):
+				t.Fatalf("Expected the %s refund to be published", name)
+			}
+		}
+	}
+
+	// 2. A peer's refund moves the TAT back instead of being ignored as older
+	services.Check(&services.CheckDTO{Key: prefix + "gcra", Args: args})
+	services.Check(&services.CheckDTO{Key: prefix + "gcra", Args: args})
+	update, _ := json.Marshal(map[string]any{
+		"tat":         time.Now().UnixNano(),
+		"refunded":    int64(time.Hour),
+		"lastUpdated": time.Now().UnixNano(),
+		"instanceId":  "peer",
+	})
+	storage.GetManager().PublishUpdates(limiter.GetUpdatesKey(limiter.GCRA, prefix+"gcra", args), update)
+	time.Sleep(100 * time.Millisecond)
+	if _, headers, _ := services.Check(&services.CheckDTO{Key: prefix + "gcra", Args: args}); headers["X-RateLimit-Remaining"] != "3" {
+		t.Errorf("Expected the peer's refund to be applied, got %v", headers)
+	}
+	services.Check(&services.CheckDTO{Key: prefix + "leaky", Args: args})
+	services.Check(&services.CheckDTO{Key: prefix + "leaky", Args: args})
+	update, _ = json.Marshal(map[string]any{
+		"nextFree":    time.Now().UnixNano(),
+		"refunded":    int64(1000 * time.Second),
+		"lastUpdated": time.Now().UnixNano(),
+		"instanceId":  "peer",
+	})
+	storage.GetManager().PublishUpdates(limiter.GetUpdatesKey(limiter.LEAKY_BUCKET, prefix+"leaky", args), update)
+	time.Sleep(100 * time.Millisecond)
+	if _, headers, _ := services.Check(&services.CheckDTO{Key: prefix + "leaky", Args: args}); headers["X-RateLimit-Remaining"] != "4" {
+		t.Errorf("Expected the peer's refund to be applied, got %v", headers)
+	}
+}
+
+func TestLeakyBucketLimiter(t *testing.T) {
+	// Leak 1 request per second, queue at most 2 requests
+	lb := &limiter.LeakyBucketLimiter{
+		LeakRate:   1,
+		QueueDepth: 2,
+	}
+
+	// 1. First request passes without delay, the next 2 are queued
+	expectedDelays := []int{0, 1000, 2000}
+	for i, expected := range expectedDelays {
+		allowed, headers, _ := lb.Check(1)
+		if !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+		delay, _ := strconv.Atoi(headers[limiter.DELAY_HEADER])
+		if delay < expected-50 || delay > expected {
+			t.Errorf("Expected request %d to be delayed ~%dms, got %dms", i+1, expected, delay)
+		}
+	}
+
+	// 2. Queue is full, next request should be rejected
+	if allowed, _, _ := lb.Check(1); allowed {
+		t.Errorf("Expected request to be denied when the queue is full")
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	// At most 2 requests in flight, leases reclaimed after 1 second
+	cc := &limiter.ConcurrencyLimiter{
+		MaxConcurrent: 2,
+		LeaseTTL:      time.Second,
+	}
+
+	// 1. Should hand out 2 leases
+	leases := []string{}
+	for i := range 2 {
+		allowed, headers, _ := cc.Check(1)
+		if !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+		leases = append(leases, headers[limiter.LEASE_HEADER])
+	}
+
+	// 2. Third request should be denied while both are in flight
+	if allowed, _, _ := cc.Check(1); allowed {
+		t.Errorf("Expected request to be denied when all slots are taken")
+	}
+
+	// 3. Releasing a lease frees its slot
+	if err := cc.Release(leases[0]); err != nil {
+		t.Errorf("Expected lease to be released, got %v", err)
+	}
+	if allowed, _, _ := cc.Check(1); !allowed {
+		t.Errorf("Expected request to be allowed after a release")
+	}
+
+	// 4. Leases that are never released expire
+	time.Sleep(1100 * time.Millisecond)
+	if allowed, _, _ := cc.Check(1); !allowed {
+		t.Errorf("Expected request to be allowed after leases expired")
+	}
+}
+
+func TestQuotaLimiter(t *testing.T) {
+	// 2 requests per calendar hour in New York
+	q := &limiter.QuotaLimiter{
+		Limit:    2,
+		Period:   limiter.QUOTA_PERIOD_HOUR,
+		Timezone: "America/New_York",
+	}
+
+	// 1. Should allow the whole quota
+	for i := range 2 {
+		if allowed, _, _ := q.Check(1); !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+	}
+
+	// 2. Next request should be denied until the next hour
+	allowed, headers, _ := q.Check(1)
+	if allowed {
+		t.Errorf("Expected request to be denied when quota is used up")
+	}
+	now := time.Now()
+	expectedReset := int(now.Truncate(time.Hour).Add(time.Hour).Sub(now).Seconds())
+	if reset, _ := strconv.Atoi(headers["X-RateLimit-Reset"]); reset < expectedReset || reset > expectedReset+1 {
+		t.Errorf("Expected reset at the next hour (%ds), got %ds", expectedReset, reset)
+	}
+}
+
+func TestWeightedTokenBucketLimiter(t *testing.T) {
+	tb := &limiter.TokenBucketLimiter{
+		Capacity:   10,
+		RefillRate: 1,
+		Tokens:     10, // Start full
+		LastRefill: time.Now(),
+	}
+
+	// 1. A request costing 7 units leaves 3
+	allowed, headers, _ := tb.Check(7)
+	if !allowed {
+		t.Errorf("Expected weighted request to be allowed, but it was denied")
+	}
+	if headers["X-RateLimit-Remaining"] != "3" {
+		t.Errorf("Expected 3 units remaining, got %s", headers["X-RateLimit-Remaining"])
+	}
+
+	// 2. A request costing more than what is left is denied without consuming
+	allowed, headers, _ = tb.Check(5)
+	if allowed {
+		t.Errorf("Expected request to be denied when only part of the cost is available")
+	}
+	if headers["X-RateLimit-Remaining"] != "3" || headers["Retry-After"] != "2" {
+		t.Errorf("Expected 3 units remaining and retry after 2s, got %s and %s",
+			headers["X-RateLimit-Remaining"], headers["Retry-After"])
+	}
+
+	// 3. What is left can still be used
+	if allowed, _, _ := tb.Check(3); !allowed {
+		t.Errorf("Expected request for the remaining units to be allowed")
+	}
+}
+
+func TestCompositeLimiter(t *testing.T) {
+	key := fmt.Sprintf("composite-%d", time.Now().UnixNano())
+	// 5 tokens refilled slowly AND 3 requests per minute
+	err := services.Configure(&services.ConfigureDTO{
+		Key:         key,
+		LimiterType: limiter.COMPOSITE,
+		Configuration: json.RawMessage(`{"limits": [
+			{"limiterType": 10, "configuration": {"capacity": 5, "refillRate": 0.001}},
+			{"limiterType": 30, "configuration": {"capacity": 3, "windowSize": 60, "alignment": "first-request"}}
+		]}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected composite limiter to be configured, got %v", err)
+	}
+
+	// 1. Should allow 3 requests, reporting the fixed window as most restrictive
+	for i := range 3 {
+		allowed, headers, _ := services.Check(&services.CheckDTO{Key: key})
+		if !allowed {
+			t.Errorf("Expected request %d to be allowed, but it was denied", i+1)
+		}
+		if expected := strconv.Itoa(2 - i); headers["X-RateLimit-Remaining"] != expected {
+			t.Errorf("Expected %s remaining, got %s", expected, headers["X-RateLimit-Remaining"])
+		}
+	}
+
+	// 2. Fourth request is denied by the fixed window
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key}); allowed {
+		t.Errorf("Expected request to be denied when one of the limits is reached")
+	}
+
+	// 3. The token bucket got its token back: 5 - 3 allowed - 1 now = 1 left
+	_, headers, _ := services.Check(&services.CheckDTO{Key: key + "#0"})
+	if headers["X-RateLimit-Remaining"] != "1" {
+		t.Errorf("Expected the denied request to be refunded, got %s remaining", headers["X-RateLimit-Remaining"])
+	}
+
+	// 4. Sub-limits dropped by a new configuration are deleted
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.COMPOSITE,
+		Configuration: json.RawMessage(`{"limits": [{"limiterType": 10, "configuration": {"capacity": 5, "refillRate": 0.001}}]}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected composite limiter to be reconfigured, got %v", err)
+	}
+	if _, err := services.GetConfiguration(key + "#1"); err == nil {
+		t.Errorf("Expected the dropped sub-limit to be deleted")
+	}
+
+	// 5. Composite limits can't be sub-limits
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.COMPOSITE,
+		Configuration: json.RawMessage(`{"limits": [{"limiterType": 90, "configuration": {"limits": [{"limiterType": 10, "configuration": {"capacity": 5, "refillRate": 1}}]}}]}`),
+	})
+	if err == nil {
+		t.Errorf("Expected nested composite limits to be rejected")
+	}
+}
+
+func TestHierarchicalLimiter(t *testing.T) {
+	key := fmt.Sprintf("hierarchical-%d", time.Now().UnixNano())
+	// 3 requests per minute globally, 2 per minute per tenant (args[0])
+	err := services.Configure(&services.ConfigureDTO{
+		Key:         key,
+		LimiterType: limiter.HIERARCHICAL,
+		Configuration: json.RawMessage(`{"levels": [
+			{"limiterType": 30, "configuration": {"capacity": 3, "windowSize": 60, "alignment": "first-request"}},
+			{"limiterType": 30, "configuration": {"capacity": 2, "windowSize": 60, "alignment": "first-request"}}
+		]}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected hierarchical limiter to be configured, got %v", err)
+	}
+	check := func(tenant string, user string) bool {
+		allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{tenant, user}})
+		return allowed
+	}
+
+	// 1. Tenant A can use its own limit across users
+	if !check("A", "u1") || !check("A", "u2") {
+		t.Errorf("Expected tenant A to be allowed 2 requests")
+	}
+
+	// 2. Tenant A is denied at its level, and the global level is rolled back
+	if check("A", "u3") {
+		t.Errorf("Expected tenant A to be denied above its limit")
+	}
+
+	// 3. Tenant B gets the last global request, then the global level denies
+	if !check("B", "u1") {
+		t.Errorf("Expected tenant B to be allowed the last global request")
+	}
+	if check("B", "u2") {
+		t.Errorf("Expected tenant B to be denied once the global limit is reached")
+	}
+
+	// 4. Levels dropped by a new configuration are deleted, levels can't nest
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.HIERARCHICAL,
+		Configuration: json.RawMessage(`{"levels": [{"limiterType": 30, "configuration": {"capacity": 3, "windowSize": 60}}]}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected hierarchical limiter to be reconfigured, got %v", err)
+	}
+	if _, err := services.GetConfiguration(key + "#1"); err == nil {
+		t.Errorf("Expected the dropped level to be deleted")
+	}
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.HIERARCHICAL,
+		Configuration: json.RawMessage(`{"levels": [{"limiterType": 100, "configuration": {"levels": [{"limiterType": 30, "configuration": {"capacity": 3, "windowSize": 60}}]}}]}`),
+	})
+	if err == nil {
+		t.Errorf("Expected nested hierarchical levels to be rejected")
+	}
+}
+
+func TestLimiterOverrides(t *testing.T) {
+	key := fmt.Sprintf("overrides-%d", time.Now().UnixNano())
+	// 1 request per minute for everyone...
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 1, "windowSize": 60, "alignment": "first-request"}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	// ...but 3 per minute for enterprise tenants
+	err = services.ConfigureOverride(key, &services.OverrideDTO{
+		Name:          "enterprise",
+		ArgIndex:      1,
+		Match:         "enterprise-*",
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 3, "windowSize": 60, "alignment": "first-request"}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected override to be configured, got %v", err)
+	}
+	countAllowed := func(args []string) int {
+		allowedCount := 0
+		for range 4 {
+			if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: args}); allowed {
+				allowedCount++
+			}
+		}
+		return allowedCount
+	}
+
+	if allowedCount := countAllowed([]string{"/hello", "free-1"}); allowedCount != 1 {
+		t.Errorf("Expected 1 request allowed for a regular tenant, got %d", allowedCount)
+	}
+	if allowedCount := countAllowed([]string{"/hello", "enterprise-1"}); allowedCount != 3 {
+		t.Errorf("Expected 3 requests allowed for an enterprise tenant, got %d", allowedCount)
+	}
+
+	// Names can't contain the characters keys are built with
+	err = services.ConfigureOverride(key, &services.OverrideDTO{
+		Name:          "enterprise:eu",
+		ArgIndex:      1,
+		Match:         "eu-*",
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 2, "windowSize": 60, "alignment": "first-request"}`),
+	})
+	if err == nil {
+		t.Errorf("Expected override names containing ':' to be rejected")
+	}
+
+	// Deleting an override leaves the state of one its name is a prefix of
+	err = services.ConfigureOverride(key, &services.OverrideDTO{
+		Name:          "enterprise-eu",
+		ArgIndex:      1,
+		Match:         "eu-*",
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 2, "windowSize": 60, "alignment": "first-request"}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected override to be configured, got %v", err)
+	}
+	services.Check(&services.CheckDTO{Key: key, Args: []string{"/hello", "eu-1"}})
+	// Stored rather than live state is what deleting could wipe
+	limiter.GetManager().StopAll()
+	if err := services.DeleteOverride(key, "enterprise"); err != nil {
+		t.Fatalf("Expected override to be deleted, got %v", err)
+	}
+	if allowedCount := countAllowed([]string{"/hello", "eu-1"}); allowedCount != 1 {
+		t.Errorf("Expected the other override to keep its count, got %d allowed", allowedCount)
+	}
+	if allowedCount := countAllowed([]string{"/hello", "enterprise-1"}); allowedCount != 1 {
+		t.Errorf("Expected the deleted override to no longer apply, got %d allowed", allowedCount)
+	}
+}
+
+func TestConfigurationBounds(t *testing.T) {
+	invalid := []struct {
+		limiterType   limiter.LimiterType
+		configuration string
+	}{
+		{limiter.GCRA, `{"rate": -1, "period": 1, "burst": 1}`},
+		{limiter.GCRA, `{"rate": 1, "period": -1, "burst": 1}`},
+		{limiter.GCRA, `{"rate": 1, "period": 1, "burst": -1}`},
+		{limiter.FIXED_WINDOW, `{"capacity": -1, "windowSize": 60}`},
+		{limiter.FIXED_WINDOW, `{"capacity": 1, "windowSize": -60}`},
+		{limiter.SLIDING_WINDOW_COUNTER, `{"capacity": -1, "windowSize": 60}`},
+		{limiter.SLIDING_WINDOW_COUNTER, `{"capacity": 1, "windowSize": -60}`},
+		{limiter.LEAKY_BUCKET, `{"leakRate": -1}`},
+		{limiter.QUOTA, `{"limit": -1, "period": "day"}`},
+		{limiter.CONCURRENCY, `{"maxConcurrent": -3, "leaseTTL": 60}`},
+	}
+	for _, c := range invalid {
+		if err := limiter.ValidateConfiguration(c.limiterType, json.RawMessage(c.configuration)); err == nil {
+			t.Errorf("Expected %s to be rejected for type %d", c.configuration, c.limiterType)
+		}
+	}
+}
+
+func TestConfigurationLifecycle(t *testing.T) {
+	key := fmt.Sprintf("crud-%d", time.Now().UnixNano())
+	configuration := json.RawMessage(`{"limits": [{"limiterType": 10, "configuration": {"capacity": 5, "refillRate": 1}}]}`)
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.COMPOSITE,
+		Configuration: configuration,
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// 1. The configuration reads back as it was written
+	stored, err := services.GetConfiguration(key)
+	if err != nil || stored.LimiterType != limiter.COMPOSITE || string(stored.Configuration) != string(configuration) {
+		t.Errorf("Expected configuration to read back, got %+v (%v)", stored, err)
+	}
+
+	// 2. Listing by prefix finds the key but not its sub-limits
+	list, err := services.ListConfigurations(&services.ListConfigurationsDTO{Prefix: key, Count: 1000})
+	if err != nil {
+		t.Fatalf("Expected configurations to be listed, got %v", err)
+	}
+	for list.Cursor != 0 && len(list.Configurations) == 0 {
+		list, _ = services.ListConfigurations(&services.ListConfigurationsDTO{Prefix: key, Cursor: list.Cursor, Count: 1000})
+	}
+	if len(list.Configurations) != 1 || list.Configurations[0].Key != key {
+		t.Errorf("Expected only %s to be listed, got %+v", key, list.Configurations)
+	}
+
+	// 3. Deleting evicts the live limiter and the configuration
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key}); !allowed {
+		t.Errorf("Expected request to be allowed before delete")
+	}
+	if err := services.DeleteConfiguration(key, "test"); err != nil {
+		t.Fatalf("Expected configuration to be deleted, got %v", err)
+	}
+	if _, _, err := services.Check(&services.CheckDTO{Key: key}); err == nil {
+		t.Errorf("Expected check to fail once the configuration is deleted")
+	}
+	if _, err := services.GetConfiguration(key + "#0"); err == nil {
+		t.Errorf("Expected sub-limits to be deleted along with the configuration")
+	}
+
+	// 4. Keys are validated however they are given, e.g. in the PUT path
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key + "#0",
+		LimiterType:   limiter.TOKEN_BUCKET,
+		Configuration: json.RawMessage(`{"capacity": 5, "refillRate": 1}`),
+	})
+	if err == nil {
+		t.Errorf("Expected keys reserved for sub-limits to be rejected")
+	}
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key + ":v2",
+		LimiterType:   limiter.TOKEN_BUCKET,
+		Configuration: json.RawMessage(`{"capacity": 5, "refillRate": 1}`),
+	})
+	if err == nil {
+		t.Errorf("Expected keys overlapping another key's args to be rejected")
+	}
+}
+
+func TestLiveReconfiguration(t *testing.T) {
+	key := fmt.Sprintf("reconfigure-%d", time.Now().UnixNano())
+	configure := func(limiterType limiter.LimiterType, configuration string) {
+		err := services.Configure(&services.ConfigureDTO{
+			Key:           key,
+			LimiterType:   limiterType,
+			Configuration: json.RawMessage(configuration),
+		})
+		if err != nil {
+			t.Fatalf("Expected limiter to be configured, got %v", err)
+		}
+	}
+	configure(limiter.TOKEN_BUCKET, `{"capacity": 2, "refillRate": 0.001}`)
+
+	// 1. Exhaust the bucket
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Cost: 1}); !allowed {
+			t.Errorf("Request %d: Expected to be allowed", i+1)
+		}
+	}
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Cost: 1}); allowed {
+		t.Errorf("Expected request to be denied once the bucket is empty")
+	}
+
+	// 2. Raising the capacity applies to the live limiter and keeps the usage
+	configure(limiter.TOKEN_BUCKET, `{"capacity": 5, "refillRate": 0.001}`)
+	allowed, headers, _ := services.Check(&services.CheckDTO{Key: key, Cost: 1})
+	if !allowed || headers["X-RateLimit-Limit"] != "5" || headers["X-RateLimit-Remaining"] != "2" {
+		t.Errorf("Expected new capacity with usage kept, got %v %v", allowed, headers)
+	}
+
+	// 3. Changing the limiter type replaces the live limiter
+	configure(limiter.SLIDING_WINDOW, `{"capacity": 1, "windowSize": 60}`)
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Cost: 1}); !allowed {
+		t.Errorf("Expected request to be allowed by the new limiter")
+	}
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Cost: 1}); allowed {
+		t.Errorf("Expected request to be denied by the new limiter")
+	}
+}
+
+func TestLimitsFile(t *testing.T) {
+	key := fmt.Sprintf("file-%d", time.Now().UnixNano())
+	path := t.TempDir() + "/limits.yaml"
+	write := func(content string) services.LimitsFile {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		limits, err := services.ReadLimitsFile(path)
+		if err != nil {
+			t.Fatalf("Expected limits file to be read, got %v", err)
+		}
+		return limits
+	}
+
+	// 1. Invalid configurations are reported without being stored
+	limits := write(key + ":\n  limiterType: 10\n  configuration: {capacity: 2}\n")
+	if err := limits.Validate(); err == nil {
+		t.Errorf("Expected missing refillRate to be reported")
+	}
+	if _, err := services.GetConfiguration(key); err == nil {
+		t.Errorf("Expected validation not to store the configuration")
+	}
+
+	// 2. A valid file configures keys and overrides
+	limits = write(key + `:
+  limiterType: 10
+  configuration: {capacity: 1, refillRate: 0.001}
+  overrides:
+    - name: vip
+      argIndex: 0
+      match: "vip-*"
+      limiterType: 10
+      configuration: {capacity: 3, refillRate: 0.001}
+`)
+	if err := limits.Validate(); err != nil {
+		t.Fatalf("Expected limits file to be valid, got %v", err)
+	}
+	if err := limits.Apply(nil); err != nil {
+		t.Fatalf("Expected limits file to be applied, got %v", err)
+	}
+	_, headers, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"vip-1"}, Cost: 1})
+	if headers["X-RateLimit-Limit"] != "3" {
+		t.Errorf("Expected override from the file to apply, got %v", headers)
+	}
+
+	// 3. Keys dropped from the file are removed on the next apply
+	if err := write("{}").Apply(limits); err != nil {
+		t.Fatalf("Expected limits file to be applied, got %v", err)
+	}
+	if _, err := services.GetConfiguration(key); err == nil {
+		t.Errorf("Expected key removed from the file to be deleted")
+	}
+}
+
+func TestConfigurationHistory(t *testing.T) {
+	key := fmt.Sprintf("history-%d", time.Now().UnixNano())
+	for _, capacity := range []int{2, 5} {
+		err := services.Configure(&services.ConfigureDTO{
+			Key:           key,
+			LimiterType:   limiter.TOKEN_BUCKET,
+			Configuration: json.RawMessage(fmt.Sprintf(`{"capacity": %d, "refillRate": 1}`, capacity)),
+			Author:        "alice",
+		})
+		if err != nil {
+			t.Fatalf("Expected limiter to be configured, got %v", err)
+		}
+	}
+
+	// 1. Each write is a version with its author and diff
+	versions, err := services.GetConfigurationHistory(key)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %+v (%v)", versions, err)
+	}
+	change, changed := versions[1].Diff["capacity"]
+	if versions[1].Version != 2 || versions[1].Author != "alice" || !changed || change.From != float64(2) || change.To != float64(5) {
+		t.Errorf("Expected capacity change from 2 to 5 by alice, got %+v", versions[1])
+	}
+	if _, changed := versions[1].Diff["refillRate"]; changed {
+		t.Errorf("Expected unchanged fields to be left out of the diff, got %+v", versions[1].Diff)
+	}
+
+	// 2. Rolling back restores the version and records a new one
+	if err := services.RollbackConfiguration(key, &services.RollbackDTO{Version: 1}, "bob"); err != nil {
+		t.Fatalf("Expected rollback to succeed, got %v", err)
+	}
+	stored, _ := services.GetConfiguration(key)
+	if string(stored.Configuration) != `{"capacity":2,"refillRate":1}` {
+		t.Errorf("Expected version 1 to be restored, got %s", stored.Configuration)
+	}
+	versions, _ = services.GetConfigurationHistory(key)
+	if len(versions) != 3 || versions[2].Author != "bob" {
+		t.Errorf("Expected rollback to be recorded as version 3, got %+v", versions)
+	}
+	if err := services.RollbackConfiguration(key, &services.RollbackDTO{Version: 10}, "bob"); err == nil || err.Error() != "version not found" {
+		t.Errorf("Expected unknown version to be rejected, got %v", err)
+	}
+}
+
+func TestStrictConsistency(t *testing.T) {
+	key := fmt.Sprintf("strict-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.TOKEN_BUCKET,
+		Configuration: json.RawMessage(`{"capacity": 3, "refillRate": 0.001}`),
+		Consistency:   limiter.CONSISTENCY_STRICT,
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// 1. Concurrent checks are decided atomically in storage
+	var allowedCount atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1}); allowed {
+				allowedCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowedCount.Load() != 3 {
+		t.Errorf("Expected exactly 3 requests to be allowed, got %d", allowedCount.Load())
+	}
+	_, headers, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if headers["X-RateLimit-Remaining"] != "0" || headers["Retry-After"] == "" {
+		t.Errorf("Expected empty bucket headers, got %v", headers)
+	}
+
+	// 2. Sliding windows are strict too
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.SLIDING_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 2, "windowSize": 60}`),
+		Consistency:   limiter.CONSISTENCY_STRICT,
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+		if allowed != (i < 2) {
+			t.Errorf("Request %d: Expected allowed=%v, got %v", i+1, i < 2, allowed)
+		}
+	}
+
+	// 3. Other limiter types can't be strict
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.GCRA,
+		Configuration: json.RawMessage(`{"rate": 1, "period": 1, "burst": 1}`),
+		Consistency:   limiter.CONSISTENCY_STRICT,
+	})
+	if err == nil {
+		t.Errorf("Expected strict GCRA to be rejected")
+	}
+}
+
+func TestSlidingWindowRefund(t *testing.T) {
+	key := fmt.Sprintf("swrefund-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.SLIDING_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 3, "windowSize": 60}`),
+		Consistency:   limiter.CONSISTENCY_STRICT,
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	rateLimiter, err := limiter.GetManager().AccessLimiter(key, []string{"user"})
+	if err != nil {
+		t.Fatalf("Expected limiter to be accessed, got %v", err)
+	}
+	if allowed, _, _ := (*rateLimiter).Check(1); !allowed {
+		t.Fatalf("Expected request to be allowed")
+	}
+
+	// A peer logs a request after ours, the refund must only remove ours
+	strictKey := limiter.GetStrictLimiterKey(limiter.SLIDING_WINDOW, key, []string{"user"})
+	peer := time.Now().UnixNano()
+	storage.GetManager().AddToWindow(strictKey, 3, time.Minute, 1, storage.NewWindowMember(peer))
+	limiter.Refund(rateLimiter, 1, nil)
+
+	logged, _ := storage.GetManager().GetWindowLog(strictKey, time.Time{})
+	if len(logged) != 1 || logged[0] != peer {
+		t.Errorf("Expected only the peer's request to be left, got %v", logged)
+	}
+}
+
+func TestSlidingWindowPeerUpdates(t *testing.T) {
+	key := fmt.Sprintf("swpeers-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.SLIDING_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 4, "windowSize": 60}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1}); !allowed {
+		t.Fatalf("Expected request to be allowed")
+	}
+
+	// A peer logs 2 requests, then refunds one of them
+	time.Sleep(100 * time.Millisecond)
+	updatesKey := limiter.GetUpdatesKey(limiter.SLIDING_WINDOW, key, []string{"user"})
+	now := time.Now().UnixNano()
+	publish := func(update map[string]any) {
+		update["lastUpdated"] = time.Now().UnixNano()
+		update["instanceId"] = "peer"
+		jsonData, _ := json.Marshal(update)
+		storage.GetManager().PublishUpdates(updatesKey, jsonData)
+		time.Sleep(100 * time.Millisecond)
+	}
+	publish(map[string]any{"requestLogs": []int64{now, now + 1}})
+	_, headers, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if headers["X-RateLimit-Remaining"] != "0" {
+		t.Errorf("Expected the peer's requests to be counted, got %v", headers)
+	}
+	publish(map[string]any{"removed": []int64{now + 1}})
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1}); !allowed {
+		t.Errorf("Expected the peer's refund to free a request")
+	}
+}
+
+func TestSlidingWindowLogMigration(t *testing.T) {
+	key := fmt.Sprintf("swlog-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           key,
+		LimiterType:   limiter.SLIDING_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 3, "windowSize": 60}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// A window stored before logs were sorted sets
+	now := time.Now().UnixNano()
+	legacy := struct {
+		RequestLogs []int64 `json:"requestLog"`
+	}{RequestLogs: []int64{now - int64(time.Second), now}}
+	storage.GetManager().SetLimiterData(limiter.GetLimiterKey(limiter.SLIDING_WINDOW, key, []string{"user"}), &legacy, 60)
+
+	allowed, headers, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1})
+	if !allowed || headers["X-RateLimit-Remaining"] != "0" {
+		t.Errorf("Expected the migrated log to count, got %v %v", allowed, headers)
+	}
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key, Args: []string{"user"}, Cost: 1}); allowed {
+		t.Errorf("Expected request to be denied once the window is full")
+	}
+}
+
+func TestClusterHashTags(t *testing.T) {
+	mode := config.REDIS_MODE
+	defer func() { config.REDIS_MODE = mode }()
+
+	config.REDIS_MODE = storage.REDIS_MODE_CLUSTER
+	leases := limiter.GetLimiterKey(limiter.CONCURRENCY, "api", []string{"user"})
+	if leases != "limiter:cc:{api}:user" {
+		t.Errorf("Expected the key to be hash tagged, got %s", leases)
+	}
+	if updates := limiter.GetUpdatesKey(limiter.TOKEN_BUCKET, "api", nil); updates != "updates:tbl:{api}" {
+		t.Errorf("Expected the channel to be hash tagged, got %s", updates)
+	}
+
+	config.REDIS_MODE = storage.REDIS_MODE_STANDALONE
+	if key := limiter.GetLimiterKey(limiter.CONCURRENCY, "api", []string{"user"}); key != "limiter:cc:api:user" {
+		t.Errorf("Expected keys outside a cluster to be unchanged, got %s", key)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	key := fmt.Sprintf("missing-%d", time.Now().UnixNano())
+
+	// 1. Unconfigured keys are reported instead of panicking
+	if _, err := limiter.GetManager().AccessLimiter(key, nil); err == nil || err.Error() != "key not configured" {
+		t.Errorf("Expected key not configured, got %v", err)
+	}
+	if _, _, err := services.Check(&services.CheckDTO{Key: key}); err == nil || err.Error() != "rate limiter not found" {
+		t.Errorf("Expected rate limiter not found, got %v", err)
+	}
+
+	// 2. The degraded mode only applies while storage is unavailable
+	mode := config.DEGRADED_MODE
+	defer func() { config.DEGRADED_MODE = mode }()
+	config.DEGRADED_MODE = services.DEGRADED_MODE_FAIL_OPEN
+	if allowed, _, err := services.Check(&services.CheckDTO{Key: key}); allowed || err == nil {
+		t.Errorf("Expected unconfigured keys to be denied while storage is available")
+	}
+}
+
+func TestDiskStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+	disk, err := storage.NewDiskManager(path)
+	if err != nil {
+		t.Fatalf("Expected disk storage to open, got %v", err)
+	}
+
+	// 1. Configurations and quota usage are written to the file
+	quota := &limiter.QuotaLimiter{Limit: 100, Period: "day", Count: 42}
+	if err := disk.SetConfigureData("quota", limiter.QUOTA, quota); err != nil {
+		t.Fatalf("Expected configuration to be stored, got %v", err)
+	}
+	if err := disk.SetLimiterData("limiter:quota:quota:user", quota, 3600); err != nil {
+		t.Fatalf("Expected quota usage to be stored, got %v", err)
+	}
+	disk.SetConfigureData("deleted", limiter.QUOTA, quota)
+	disk.DeleteConfigureData("deleted")
+
+	// 2. Updates fan out to local subscribers
+	sub := disk.SubscribeUpdates("updates:quota:quota")
+	defer sub.Close()
+	disk.PublishUpdates("updates:quota:quota", "hello")
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != "hello" {
+			t.Errorf("Expected the published payload, got %s", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the update to be delivered")
+	}
+
+	// 3. A restart reads everything back
+	restarted, err := storage.NewDiskManager(path)
+	if err != nil {
+		t.Fatalf("Expected disk storage to reopen, got %v", err)
+	}
+	if limiterType, err := restarted.GetConfigureType("quota"); err != nil || limiterType != limiter.QUOTA {
+		t.Errorf("Expected the configuration to survive a restart, got %d %v", limiterType, err)
+	}
+	restored := &limiter.QuotaLimiter{}
+	if err := restarted.GetLimiterData("limiter:quota:quota:user", restored); err != nil || restored.Count != 42 {
+		t.Errorf("Expected the quota usage to survive a restart, got %d %v", restored.Count, err)
+	}
+	if _, err := restarted.GetConfigureType("deleted"); err == nil {
+		t.Errorf("Expected deleted configurations to stay deleted")
+	}
+
+	// 4. A record cut short at the end of the file is dropped
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"kind":"hash","key":"configure:torn","ha`)
+	file.Close()
+	if torn, err := storage.NewDiskManager(path); err != nil {
+		t.Errorf("Expected a torn last record to be dropped, got %v", err)
+	} else if _, err := torn.GetConfigureType("quota"); err != nil {
+		t.Errorf("Expected the records before it to be read back, got %v", err)
+	}
+
+	// 5. A malformed record before the last one fails the restart
+	corrupted := filepath.Join(t.TempDir(), "corrupted.log")
+	os.WriteFile(corrupted, []byte("{\"kind\":\"hash\",\"key\":\"configure:a\"}\nnot json\n{\"kind\":\"hash\",\"key\":\"configure:b\"}\n"), 0o644)
+	if _, err := storage.NewDiskManager(corrupted); err == nil {
+		t.Errorf("Expected a corrupted journal to be reported")
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	key := fmt.Sprintf("grpc-%d", time.Now().UnixNano())
+	logger.InitLogger(filepath.Join(t.TempDir(), "logs.csv"), 100)
+	server := rpc.NewServer()
+	ctx := context.Background()
+
+	// 1. Configure goes through the same validation as the HTTP API
+	if _, err := server.Configure(ctx, &ratelimiterpb.ConfigureRequest{Key: key, LimiterType: limiter.TOKEN_BUCKET, Configuration: "{"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid configurations to be rejected, got %v", err)
+	}
+	_, err := server.Configure(ctx, &ratelimiterpb.ConfigureRequest{
+		Key:           key,
+		LimiterType:   limiter.TOKEN_BUCKET,
+		Configuration: `{"capacity": 2, "refillRate": 0.001}`,
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// 2. Check answers with the limiter headers
+	response, err := server.Check(ctx, &ratelimiterpb.CheckRequest{Key: key, Args: []string{"user"}})
+	if err != nil || !response.Allowed || response.Headers["X-RateLimit-Limit"] != "2" {
+		t.Errorf("Expected request to be allowed with headers, got %+v (%v)", response, err)
+	}
+	if _, err := server.Check(ctx, &ratelimiterpb.CheckRequest{Key: key + "-missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected unknown keys to be not found, got %v", err)
+	}
+
+	// 3. CheckBatch reports each item on its own
+	batch, err := server.CheckBatch(ctx, &ratelimiterpb.CheckBatchRequest{Items: []*ratelimiterpb.CheckRequest{
+		{Key: key, Args: []string{"user"}},
+		{Key: key, Args: []string{"user"}},
+		{Key: key + "-missing"},
+	}})
+	if err != nil || len(batch.Results) != 3 {
+		t.Fatalf("Expected 3 batch results, got %+v (%v)", batch, err)
+	}
+	if !batch.Results[0].Allowed || batch.Results[1].Allowed || batch.Results[2].Error == "" {
+		t.Errorf("Expected allowed, denied and failed results, got %+v", batch.Results)
+	}
+
+	// 4. Metrics are shared with the HTTP API and updated in the background
+	time.Sleep(50 * time.Millisecond)
+	if metrics, err := server.GetMetrics(ctx, &ratelimiterpb.GetMetricsRequest{}); err != nil || metrics.TotalRequests == 0 {
+		t.Errorf("Expected checks to be counted, got %+v (%v)", metrics, err)
+	}
+}
+
+func TestGRPCClients(t *testing.T) {
+	prefix := fmt.Sprintf("grpcclient-%d", time.Now().UnixNano())
+	logger.InitLogger(filepath.Join(t.TempDir(), "logs.csv"), 100)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected a listener, got %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	ratelimiterpb.RegisterRateLimiterServer(grpcServer, rpc.NewServer())
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	conn, err := sdk.DialGRPC(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected a connection, got %v", err)
+	}
+	defer conn.Close()
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           prefix + ".api",
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 1, "windowSize": 60}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+
+	// 1. WatchLimits lists the configured limits, then streams the changes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := ratelimiterpb.NewRateLimiterClient(conn).WatchLimits(ctx, &ratelimiterpb.WatchLimitsRequest{KeyPrefix: prefix})
+	if err != nil {
+		t.Fatalf("Expected to watch limits, got %v", err)
+	}
+	update, err := stream.Recv()
+	if err != nil || update.Key != prefix+".api" || update.LimiterType != limiter.FIXED_WINDOW {
+		t.Fatalf("Expected the configured limit to be listed, got %v (%v)", update, err)
+	}
+	services.DeleteConfiguration(prefix+".api", "test")
+	if update, err := stream.Recv(); err != nil || update.Key != prefix+".api" || !update.Deleted {
+		t.Errorf("Expected the deletion to be streamed, got %v (%v)", update, err)
+	}
+	err = services.Configure(&services.ConfigureDTO{
+		Key:           prefix + ".web",
+		LimiterType:   limiter.FIXED_WINDOW,
+		Configuration: json.RawMessage(`{"capacity": 1, "windowSize": 60}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	if update, err := stream.Recv(); err != nil || update.Key != prefix+".web" || update.Configuration == "" {
+		t.Errorf("Expected the new limit to be streamed, got %v (%v)", update, err)
+	}
+
+	// 2. The SDK middleware checks every request over the connection
+	app := fiber.New()
+	app.Use(sdk.GRPCMiddleware(sdk.Config{
+		Key:           prefix + ".web",
+		ArgsExtractor: func(c fiber.Ctx) ([]string, error) { return []string{"user"}, nil },
+	}, conn))
+	app.Get("/", func(c fiber.Ctx) error { return c.SendString("ok") })
+	for i, expected := range []int{fiber.StatusOK, fiber.StatusTooManyRequests} {
+		response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil || response.StatusCode != expected || response.Header.Get("X-RateLimit-Limit") != "1" {
+			t.Errorf("Request %d: Expected status %d with headers, got %v (%v)", i+1, expected, response, err)
+		}
+	}
+}
+
+func TestEnvoyRateLimitService(t *testing.T) {
+	domain := fmt.Sprintf("edge-%d", time.Now().UnixNano())
+	err := services.Configure(&services.ConfigureDTO{
+		Key:           domain + ".remote_address",
+		LimiterType:   limiter.TOKEN_BUCKET,
+		Configuration: json.RawMessage(`{"capacity": 2, "refillRate": 0.001}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	server := rpc.NewEnvoyServer()
+	request := &rlsv3.RateLimitRequest{
+		Domain: domain,
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			{Entries: []*ratelimitv3.RateLimitDescriptor_Entry{{Key: "remote_address", Value: "10.0.0.1"}}},
+			{Entries: []*ratelimitv3.RateLimitDescriptor_Entry{{Key: "path", Value: "/users"}}},
+		},
+	}
+
+	// 1. Configured descriptors are limited, the others always pass
+	for i := range 2 {
+		response, err := server.ShouldRateLimit(context.Background(), request)
+		if err != nil || response.OverallCode != rlsv3.RateLimitResponse_OK {
+			t.Fatalf("Expected request %d to be allowed, got %v (%v)", i+1, response, err)
+		}
+		if limit := response.Statuses[0].CurrentLimit; limit == nil || limit.RequestsPerUnit != 2 || response.Statuses[0].LimitRemaining != uint32(1-i) {
+			t.Errorf("Expected the limit and remaining of the descriptor, got %v", response.Statuses[0])
+		}
+		if response.Statuses[1].Code != rlsv3.RateLimitResponse_OK || response.Statuses[1].CurrentLimit != nil {
+			t.Errorf("Expected unconfigured descriptors to be unlimited, got %v", response.Statuses[1])
+		}
+	}
+
+	// 2. Once a descriptor is over its limit the whole request is
+	response, err := server.ShouldRateLimit(context.Background(), request)
+	if err != nil || response.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT || response.Statuses[0].Code != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("Expected request to be over limit, got %v (%v)", response, err)
+	}
+	headers := map[string]string{}
+	for _, header := range response.ResponseHeadersToAdd {
+		headers[header.Key] = header.Value
+	}
+	if headers["X-RateLimit-Limit"] != "2" || headers["X-RateLimit-Remaining"] != "0" {
+		t.Errorf("Expected the rate limit headers, got %v", headers)
+	}
+
+	// 3. Other values of the entries are limited on their own
+	request.Descriptors[0].Entries[0].Value = "10.0.0.2"
+	if response, err := server.ShouldRateLimit(context.Background(), request); err != nil || response.OverallCode != rlsv3.RateLimitResponse_OK {
+		t.Errorf("Expected another address to be allowed, got %v (%v)", response, err)
+	}
+
+	// 4. A zero addend reads the limit without taking from it
+	request.Descriptors[0].HitsAddend = wrapperspb.UInt64(0)
+	for range 2 {
+		response, err := server.ShouldRateLimit(context.Background(), request)
+		if err != nil || response.OverallCode != rlsv3.RateLimitResponse_OK || response.Statuses[0].LimitRemaining != 1 {
+			t.Errorf("Expected the remaining requests to be read, got %v (%v)", response, err)
+		}
+	}
+}
+
+func TestAuthMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yml")
+	os.WriteFile(path, []byte(`
+- host: "*.example.com"
+  path: /v1/**
+  key: api
+  args: [header:X-Api-Key, method, query:page]
+- path: /login
+  key: login
+`), 0o644)
+	mappings, err := services.ReadAuthMappings(path)
+	if err != nil || mappings.Validate() != nil {
+		t.Fatalf("Expected auth mappings to be read, got %v", err)
+	}
+
+	// 1. Forwarded headers pick the mapping and fill its args
+	headers := map[string]string{
+		"X-Forwarded-Host":   "api.example.com",
+		"X-Forwarded-Uri":    "/v1/users?page=2",
+		"X-Forwarded-Method": "POST",
+		"X-Api-Key":          "key-1",
+	}
+	header := func(name string) string { return headers[name] }
+	checkDTO := mappings.Resolve(services.NewAuthRequest(header, "limiter", "/auth", "GET", "10.0.0.9"))
+	if checkDTO == nil || checkDTO.Key != "api" || fmt.Sprint(checkDTO.Args) != "[key-1 POST 2]" {
+		t.Errorf("Expected the api mapping with the forwarded args, got %+v", checkDTO)
+	}
+
+	// 2. Mappings without args use the path, method and client address
+	headers = map[string]string{"X-Original-URI": "/login", "X-Forwarded-For": "1.2.3.4, 10.0.0.1"}
+	checkDTO = mappings.Resolve(services.NewAuthRequest(header, "limiter", "/auth", "GET", "10.0.0.9"))
+	if checkDTO == nil || checkDTO.Key != "login" || fmt.Sprint(checkDTO.Args) != "[/login GET 10.0.0.1]" {
+		t.Errorf("Expected the login mapping with the default args, got %+v", checkDTO)
+	}
+
+	// 3. X-Real-IP is preferred, addresses a client prepends are ignored
+	headers = map[string]string{"X-Original-URI": "/login", "X-Forwarded-For": "1.2.3.4, 10.0.0.1", "X-Real-IP": "10.0.0.2"}
+	request := services.NewAuthRequest(header, "limiter", "/auth", "GET", "10.0.0.9")
+	if request.IP != "10.0.0.2" {
+		t.Errorf("Expected the X-Real-IP address, got %s", request.IP)
+	}
+
+	// 4. Other requests aren't mapped
+	headers = map[string]string{"X-Forwarded-Host": "other.org", "X-Forwarded-Uri": "/v1/users"}
+	if checkDTO := mappings.Resolve(services.NewAuthRequest(header, "limiter", "/auth", "GET", "")); checkDTO != nil {
+		t.Errorf("Expected no mapping for other hosts, got %+v", checkDTO)
+	}
+
+	// 5. Unknown arg sources are rejected
+	invalid := services.AuthMappings{{Key: "api", Args: []string{"cookie"}}}
+	if invalid.Validate() == nil {
+		t.Errorf("Expected unknown args to be rejected")
+	}
+
+	// 6. Concurrency limiters are refused, nothing would release their leases
+	key := fmt.Sprintf("auth-slots-%d", time.Now().UnixNano())
+	err = services.Configure(&services.ConfigureDTO{Key: key, LimiterType: limiter.CONCURRENCY, Configuration: json.RawMessage(`{"maxConcurrent": 1, "leaseTTL": 60}`)})
+	if err != nil {
+		t.Fatalf("Expected limiter to be configured, got %v", err)
+	}
+	if _, _, err := services.CheckAuth(&services.CheckDTO{Key: key}); err == nil {
+		t.Errorf("Expected concurrency limiters to be refused")
+	}
+	if allowed, _, _ := services.Check(&services.CheckDTO{Key: key}); !allowed {
+		t.Errorf("Expected the refused check not to hold a slot")
+	}
+}
+
+func TestCheckBatch(t *testing.T) {
+	prefix := fmt.Sprintf("batch-%d", time.Now().UnixNano())
+	configurations := map[string]struct {
+		limiterType   limiter.LimiterType
+		configuration string
+	}{
+		"user":   {limiter.TOKEN_BUCKET, `{"capacity": 5, "refillRate": 0.001}`},
+		"tenant": {limiter.TOKEN_BUCKET, `{"capacity": 1, "refillRate": 0.001}`},
+		"slots":  {limiter.CONCURRENCY, `{"maxConcurrent": 1, "leaseTTL": 60}`},
+	}
+	for name, c := range configurations {
+		err := services.Configure(&services.ConfigureDTO{Key: prefix + name, LimiterType: c.limiterType, Configuration: json.RawMessage(c.configuration)})
+		if err != nil {
+			t.Fatalf("Expected %s to be configured, got %v", name, err)
+		}
+	}
+	items := func(names ...string) []services.CheckDTO {
+		checks := []services.CheckDTO{}
+		for _, name := range names {
+			checks = append(checks, services.CheckDTO{Key: prefix + name, Args: []string{"a"}})
+		}
+		return checks
+	}
+
+	// 1. All or nothing takes from every limiter while they all allow
+	response, err := services.CheckBatch(&services.CheckBatchDTO{Items: items("user", "tenant"), Mode: services.CHECK_BATCH_ALL_OR_NOTHING})
+	if err != nil || !response.Allowed || response.Results[0].Headers["X-RateLimit-Remaining"] != "4" {
+		t.Fatalf("Expected the batch to be allowed, got %+v (%v)", response, err)
+	}
+
+	// 2. Once one denies, the units and leases taken by the others are given back
+	response, err = services.CheckBatch(&services.CheckBatchDTO{Items: items("user", "slots", "tenant"), Mode: services.CHECK_BATCH_ALL_OR_NOTHING})
+	if err != nil || response.Allowed || response.Results[0].Allowed || response.Results[1].Allowed || response.Results[2].Allowed {
+		t.Fatalf("Expected the batch to be denied, got %+v (%v)", response, err)
+	}
+	response, err = services.CheckBatch(&services.CheckBatchDTO{Items: items("user", "slots")})
+	if err != nil || !response.Allowed || response.Results[0].Headers["X-RateLimit-Remaining"] != "3" {
+		t.Errorf("Expected the denied batch to be refunded, got %+v (%v)", response, err)
+	}
+
+	// 3. Independent items are allowed or denied on their own
+	response, err = services.CheckBatch(&services.CheckBatchDTO{Items: items("user", "tenant", "missing")})
+	if err != nil || response.Allowed || !response.Results[0].Allowed || response.Results[1].Allowed || response.Results[2].Error != "rate limiter not found" {
+		t.Errorf("Expected allowed, denied and failed results, got %+v (%v)", response, err)
+	}
+
+	// 4. All or nothing fails with the first item that can't be checked
+	if _, err := services.CheckBatch(&services.CheckBatchDTO{Items: items("user", "missing"), Mode: services.CHECK_BATCH_ALL_OR_NOTHING}); err == nil || err.Error() != "rate limiter not found" {
+		t.Errorf("Expected rate limiter not found, got %v", err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	prefix := fmt.Sprintf("peek-%d", time.Now().UnixNano())
+	configurations := []services.ConfigureDTO{
+		{Key: prefix + "bucket", LimiterType: limiter.TOKEN_BUCKET, Configuration: json.RawMessage(`{"capacity": 3, "refillRate": 0.001}`)},
+		{Key: prefix + "window", LimiterType: limiter.SLIDING_WINDOW, Configuration: json.RawMessage(`{"capacity": 3, "windowSize": 60}`), Consistency: limiter.CONSISTENCY_STRICT},
+		{Key: prefix + "fixed", LimiterType: limiter.FIXED_WINDOW, Configuration: json.RawMessage(`{"capacity": 3, "windowSize": 60}`)},
+	}
+	for _, configuration := range configurations {
+		if err := services.Configure(&configuration); err != nil {
+			t.Fatalf("Expected %s to be configured, got %v", configuration.Key, err)
+		}
+	}
+
+	for _, name := range []string{"bucket", "window"} {
+		checkDTO := &services.CheckDTO{Key: prefix + name, Args: []string{"user"}}
+
+		// 1. Peeking reports what is left without taking from it
+		services.Check(checkDTO)
+		for range 3 {
+			allowed, headers, err := services.Peek(checkDTO)
+			if err != nil || !allowed || headers["X-RateLimit-Remaining"] != "2" {
+				t.Errorf("Expected %s to have 2 left after peeking, got %v %v (%v)", name, allowed, headers, err)
+			}
+		}
+
+		// 2. Peeking at a bigger cost tells it would be denied
+		if allowed, _, _ := services.Peek(&services.CheckDTO{Key: checkDTO.Key, Args: checkDTO.Args, Cost: 3}); allowed {
+			t.Errorf("Expected a check of 3 on %s to be denied", name)
+		}
+		if allowed, _, _ := services.Check(&services.CheckDTO{Key: checkDTO.Key, Args: checkDTO.Args, Cost: 2}); !allowed {
+			t.Errorf("Expected the peeked units of %s to still be there", name)
+		}
+	}
+
+	// 3. Limiters that can't peek say so
+	if _, _, err := services.Peek(&services.CheckDTO{Key: prefix + "fixed"}); err == nil || err.Error() != "rate limiter does not support peek" {
+		t.Errorf("Expected fixed windows not to support peek, got %v", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	sm := storage.NewMemoryManager()
+
+	// 1. Hashes read back what was written, field by field
+	type state struct {
+		Tokens     float64   `json:"tokens"`
+		LastRefill time.Time `json:"lastRefill"`
+	}
+	written := state{Tokens: 2.5, LastRefill: time.Now().Truncate(time.Millisecond)}
+	if err := sm.SetLimiterData("limiter:tbl:api:user", written, 1); err != nil {
+		t.Fatalf("Expected limiter data to be stored, got %v", err)
+	}
+	var read state
+	if err := sm.GetLimiterData("limiter:tbl:api:user", &read); err != nil || read.Tokens != 2.5 || !read.LastRefill.Equal(written.LastRefill) {
+		t.Errorf("Expected the stored state back, got %+v %v", read, err)
+	}
+	if tokens, err := sm.GetLimiterField("limiter:tbl:api:user", "tokens"); err != nil || tokens != "2.5" {
+		t.Errorf("Expected the tokens field to be 2.5, got %q %v", tokens, err)
+	}
+
+	// 2. Deleting a limiter's data leaves keys that only share its prefix
+	sm.SetLimiterData("limiter:tbl:api", written, 60)
+	sm.SetLimiterData("limiter:tbl:apiv2:user", written, 60)
+	if err := sm.DeleteLimiterData("limiter:tbl:api"); err != nil {
+		t.Fatalf("Expected limiter data to be deleted, got %v", err)
+	}
+	if _, err := sm.GetLimiterField("limiter:tbl:api", "tokens"); err == nil {
+		t.Errorf("Expected the limiter data to be deleted")
+	}
+	if _, err := sm.GetLimiterField("limiter:tbl:apiv2:user", "tokens"); err != nil {
+		t.Errorf("Expected another key's data to be kept, got %v", err)
+	}
+
+	// 3. Limiter data expires after its TTL
+	time.Sleep(1100 * time.Millisecond)
+	if err := sm.GetLimiterData("limiter:tbl:api:user", &read); err == nil || err.Error() != storage.ErrDataNotFound {
+		t.Errorf("Expected expired data to be gone, got %v", err)
+	}
+
+	// 4. Leases are weighed against the limit, released once and expire
+	if acquired, used, _ := sm.AcquireLease("limiter:cc:api", "a", 2, 3, time.Minute); !acquired || used != 2 {
+		t.Errorf("Expected the first lease to be acquired, got %v %d", acquired, used)
+	}
+	if acquired, used, _ := sm.AcquireLease("limiter:cc:api", "b", 2, 3, time.Minute); acquired || used != 2 {
+		t.Errorf("Expected a lease over the limit to be denied, got %v %d", acquired, used)
+	}
+	if released, _ := sm.ReleaseLease("limiter:cc:api", "a"); !released {
+		t.Errorf("Expected the lease to be released")
+	}
+	if released, _ := sm.ReleaseLease("limiter:cc:api", "a"); released {
+		t.Errorf("Expected a released lease not to be released again")
+	}
+	sm.AcquireLease("limiter:cc:api", "c", 3, 3, 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if acquired, used, _ := sm.AcquireLease("limiter:cc:api", "d", 1, 3, time.Minute); !acquired || used != 1 {
+		t.Errorf("Expected expired leases to free their slots, got %v %d", acquired, used)
+	}
+
+	// 5. Updates reach the channel's subscribers until they close
+	sub := sm.SubscribeUpdates("updates:tbl:api")
+	other := sm.SubscribeUpdates("updates:tbl:other")
+	sm.PublishUpdates("updates:tbl:api", []byte(`{"tokens":1}`))
+	select {
+	case msg := <-sub.Channel():
+		if msg.Channel != "updates:tbl:api" || msg.Payload != `{"tokens":1}` {
+			t.Errorf("Expected the published update, got %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the update to be delivered")
+	}
+	select {
+	case msg := <-other.Channel():
+		t.Errorf("Expected other channels not to get the update, got %+v", msg)
+	default:
+	}
+	sub.Close()
+	other.Close()
+	sm.PublishUpdates("updates:tbl:api", []byte(`{"tokens":2}`))
+	if _, open := <-sub.Channel(); open {
+		t.Errorf("Expected a closed subscription to get no more updates")
+	}
+
+	// 6. Removing a member the window doesn't hold leaves the others
+	now := time.Now()
+	sm.AddToWindow("limiter:swl:api:user", 5, 50*time.Millisecond, 1, storage.NewWindowMember(now.UnixNano()))
+	sm.RemoveFromWindow("limiter:swl:api:user", []string{storage.NewWindowMember(now.UnixNano() - 1)})
+	if entries, _ := sm.GetWindowLog("limiter:swl:api:user", time.Time{}); len(entries) != 1 {
+		t.Errorf("Expected missing members to be skipped, got %v", entries)
+	}
+
+	// 7. Windows expire with their TTL like hashes do
+	sm.AddToWindowLog("limiter:swl:api:peer", []string{storage.NewWindowMember(now.UnixNano())}, time.Time{}, 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	for _, key := range []string{"limiter:swl:api:user", "limiter:swl:api:peer"} {
+		if entries, _ := sm.GetWindowLog(key, time.Time{}); len(entries) != 0 {
+			t.Errorf("Expected the window at %s to expire, got %v", key, entries)
+		}
+	}
+}